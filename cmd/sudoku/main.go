@@ -0,0 +1,219 @@
+package main
+
+// Command line front end for the sudoku package. Solves every puzzle in puzzles.txt (or -file) by default.
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rooklift/sudoku"
+)
+
+func main() {
+
+	solutions_only := flag.Bool("solutions", false, "Write one 81-char solution line per puzzle, and nothing else")
+	stats := flag.Bool("stats", false, "Print statistics about the puzzle file instead of solving it")
+	convert := flag.Bool("convert", false, "Convert the puzzle file from one format to another, writing to stdout")
+	from_name := flag.String("from", "line", "Input format for -convert: line, pretty, csv or sdk")
+	to_name := flag.String("to", "line", "Output format for -convert: line, pretty, csv or sdk")
+	json_output := flag.Bool("json", false, "Write one JSON object per puzzle instead of printing boards")
+	pairs := flag.Bool("pairs", false, "Also use naked and hidden pairs during the search, which shrinks the search tree")
+	solver_name := flag.String("solver", "array", "Which solver to use: array (sudoku.go) or norvig (the direct port, for comparison)")
+	compare := flag.Bool("compare", false, "Solve every puzzle with both solvers, one at a time, and compare their steps and times")
+	workers := flag.Int("workers", runtime.NumCPU(), "How many puzzles to solve at once")
+	filename := flag.String("file", "puzzles.txt", "The puzzle file to read")
+	flag.Parse()
+
+	if *convert {
+		from, err := sudoku.ParseFormat(*from_name)
+		if err != nil {
+			panic(err)
+		}
+		to, err := sudoku.ParseFormat(*to_name)
+		if err != nil {
+			panic(err)
+		}
+		f, err := os.Open(*filename)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		err = sudoku.Convert(f, os.Stdout, from, to)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if *stats {
+		grids, err := sudoku.LoadPuzzleFile(*filename)
+		if err != nil {
+			panic(err)
+		}
+		report := sudoku.DatasetStats(grids)
+		fmt.Printf("Puzzles: %d\n", report.Puzzles)
+		for _, d := range sudoku.Difficulties {
+			fmt.Printf("  %-10s %d\n", d, report.Difficulties[d])
+		}
+		fmt.Printf("Givens: mean %.2f, median %.1f\n", report.MeanGivens, report.MedianGivens)
+		fmt.Printf("Mean search tree size: %.2f\n", report.MeanSteps)
+		fmt.Printf("Non-unique: %d\n", report.NonUnique)
+		fmt.Printf("Unsolvable: %d\n", report.Unsolvable)
+		return
+	}
+
+	if *solutions_only || *json_output {
+		f, err := os.Open(*filename)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		if *json_output {
+			err = sudoku.SolveToJSON(f, os.Stdout)
+		} else {
+			err = sudoku.SolveToWriter(f, os.Stdout)
+		}
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	f, err := ioutil.ReadFile(*filename)
+
+	if err != nil {
+		panic(err)
+	}
+
+	lines := strings.Split(string(f), "\n")
+
+	if *compare {
+		var puzzles []string
+		for _, line := range lines {
+			if len(line) >= 81 {
+				puzzles = append(puzzles, line)
+			}
+		}
+		report := sudoku.CompareEngines(puzzles)
+		fmt.Printf("%8s %12s %14s %12s %14s\n", "Puzzle", "Array steps", "Array time", "Norvig steps", "Norvig time")
+		for i, r := range report.Results {
+			if r.Err != nil {
+				fmt.Printf("%8d   (%v)\n", i + 1, r.Err)
+				continue
+			}
+			fmt.Printf("%8d %12d %14v %12d %14v\n", i + 1, r.ArraySteps, r.ArrayTime, r.NorvigSteps, r.NorvigTime)
+		}
+		fmt.Printf("%8s %12d %14v %12d %14v\n", "Total", report.ArraySteps, report.ArrayTime, report.NorvigSteps, report.NorvigTime)
+		fmt.Printf("Norvig took %.1fx as long as array\n", report.Ratio())
+		return
+	}
+
+	new_solver, ok := solvers[*solver_name]
+	if !ok {
+		panic(fmt.Sprintf("unknown solver %q", *solver_name))
+	}
+
+	var results []*result
+
+	for _, line := range lines {
+
+		if len(line) < 81 {
+			continue
+		}
+
+		solver := new_solver(*pairs)
+		err := solver.Parse(line)
+		if err != nil && !is_contradiction(err) {
+			panic(err)
+		}
+		results = append(results, &result{
+			id: len(results) + 1,
+			solver: solver,
+			puzzle: solver.String(),
+			contradictory: err != nil,
+		})
+	}
+
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	start_time := time.Now()
+
+	jobs := make(chan *result)
+	var wg sync.WaitGroup
+
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				r.solve()
+			}
+		}()
+	}
+
+	for _, r := range results {
+		jobs <- r
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Everything is printed afterwards, in input order, so the output doesn't depend on the scheduling...
+
+	var fails []int
+	var solving time.Duration
+
+	for _, r := range results {
+
+		fmt.Printf("%d. New puzzle...\n", r.id)
+		print_board(r.puzzle)
+		solving += r.elapsed
+
+		if r.contradictory {
+			fmt.Printf("Contradictory puzzle! (no search needed)\n")
+			fails = append(fails, r.id)
+		} else if r.solved == false {
+			fmt.Printf("No solution found! (search tree size was %d)\n", r.solver.Steps())
+			fails = append(fails, r.id)
+		} else if r.solver.Validate() == false {
+			panic("Solution failed validation")
+		} else {
+			fmt.Printf("Solution found... (search tree size was %d)\n", r.solver.Steps())
+			print_board(r.solver.String())
+		}
+	}
+
+	if len(fails) > 0 {
+		fmt.Printf("\nFailures: %v\n", fails)
+	}
+
+	fmt.Printf("\nElapsed time: %v (solving took %v in total, over %d workers)\n", time.Now().Sub(start_time), solving, *workers)
+
+}
+
+type result struct {								// One puzzle of the batch. Only its own worker touches it until all are done.
+	id				int
+	solver			Solver
+	puzzle			string							// As parsed, for printing
+	contradictory	bool							// If so, there's no search
+	solved			bool
+	elapsed			time.Duration
+}
+
+func (self *result) solve() {
+
+	if self.contradictory {
+		return
+	}
+
+	start := time.Now()
+	self.solved = self.solver.Solve()
+	self.elapsed = time.Now().Sub(start)
+}
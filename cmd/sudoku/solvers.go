@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rooklift/sudoku"
+	"github.com/rooklift/sudoku/norvig"
+)
+
+type Solver interface {							// One puzzle, as handled by a back end. See solvers below.
+	Parse(s string) error							// Load a puzzle in the 81-char line format. Contradictions give ErrContradictoryGivens.
+	Solve() bool									// False if there's no solution
+	Validate() bool									// Whether the solution is a complete, valid grid
+	String() string									// The puzzle, or once solved the solution, in the 81-char line format
+	Steps() int										// The search tree size of the last Solve()
+}
+
+var solvers = map[string]func(pairs bool) Solver{	// The back ends for -solver. Only "array" uses -pairs.
+	"array":	func(pairs bool) Solver { return &array_solver{pairs: pairs} },
+	"norvig":	func(pairs bool) Solver { return new(norvig.Solver) },
+}
+
+func is_contradiction(err error) bool {
+	return errors.Is(err, sudoku.ErrContradictoryGivens) || errors.Is(err, norvig.ErrContradictoryGivens)
+}
+
+// ------------------------------------------------------------------------------------------------
+
+type array_solver struct {
+	grid		*sudoku.Grid						// The puzzle, then the solution if there is one
+	steps		int
+	pairs		bool
+}
+
+func (self *array_solver) Parse(s string) error {
+	grid, err := sudoku.ParseString(s)
+	self.grid = grid
+	if err == nil && grid.IsLegal() == false {
+		err = sudoku.ErrContradictoryGivens
+	}
+	return err
+}
+
+func (self *array_solver) Solve() bool {
+	var solution *sudoku.Grid
+	if self.pairs {
+		solution = self.grid.SolveWithPairs()
+	} else {
+		solution = self.grid.Solve()
+	}
+	self.steps = self.grid.Steps()					// The solution shares the counter, so this works either way
+	if solution == nil {
+		return false
+	}
+	self.grid = solution
+	return true
+}
+
+func (self *array_solver) Validate() bool {
+	return self.grid.Validate()
+}
+
+func (self *array_solver) String() string {
+	return self.grid.String()
+}
+
+func (self *array_solver) Steps() int {
+	return self.steps
+}
+
+// ------------------------------------------------------------------------------------------------
+
+func print_board(s string) {						// An 81-char line, laid out as per Grid.Print()
+	for y := 0; y < 9; y++ {
+		if y == 3 || y == 6 {
+			fmt.Printf(" ------+-------+------\n")
+		}
+		line := ""
+		for x := 0; x < 9; x++ {
+			if x == 3 || x == 6 {
+				line += " |"
+			}
+			line += " " + string(s[y * 9 + x])
+		}
+		fmt.Printf("%s\n", line)
+	}
+}
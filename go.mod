@@ -0,0 +1,3 @@
+module github.com/rooklift/sudoku
+
+go 1.17
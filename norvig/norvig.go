@@ -1,14 +1,13 @@
-package main
+package norvig
 
 // Sudoku solver with constraint propagation.
 // This version more directly ports Norvig's implementation.
-// But (when not IO-bound by the terminal) it's about 10x slower.
+// But (when not IO-bound by the terminal) it's about 10x slower - try cmd/sudoku with -solver=norvig.
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"strings"
-	"time"
 )
 
 var digits string = "123456789"
@@ -23,6 +22,8 @@ var unitlist [][]string				// 27 units which are len-9 lists of squares
 var units map[string][][]string		// Lookup table: square --> units containing it
 var peers map[string][]string		// Lookup table: square --> peers it sees
 
+var ErrContradictoryGivens = errors.New("contradictory givens")
+
 func init() {
 
 	// Names of squares
@@ -242,8 +243,10 @@ func eliminate(values map[string]string, s, d string) map[string]string {
 	return values
 }
 
-func search(values map[string]string) map[string]string {
-	
+func search(values map[string]string, steps *int) map[string]string {	// steps counts calls, comparable with sudoku.go's steps
+
+	*steps++
+
 	if values == nil {
 		return nil
 	}
@@ -277,7 +280,7 @@ func search(values map[string]string) map[string]string {
 	for _, d := range values[search_square] {
 		foo := copy_map(values)
 		assign(foo, search_square, string(d))
-		result := search(foo)
+		result := search(foo, steps)
 		if result != nil {
 			return result
 		}
@@ -286,7 +289,7 @@ func search(values map[string]string) map[string]string {
 	return nil
 }
 
-func parse_string(s string) map[string]string {
+func parse_string(s string) (map[string]string, error) {
 
 	var numstrings []string
 
@@ -299,7 +302,7 @@ func parse_string(s string) map[string]string {
 	}
 
 	if len(numstrings) != 81 {
-		panic("Bad puzzle string")
+		return nil, fmt.Errorf("bad puzzle string: got %d cells, expected 81", len(numstrings))
 	}
 
 	ret := new_map()
@@ -308,33 +311,30 @@ func parse_string(s string) map[string]string {
 		for y := 0; y < 9; y++ {
 			index := y * 9 + x
 			if numstrings[index] != "" {
-				assign(ret, name[x][y], numstrings[index])
+				if strings.Contains(ret[name[x][y]], numstrings[index]) == false || assign(ret, name[x][y], numstrings[index]) == nil {
+					return ret, ErrContradictoryGivens
+				}
 			}
 		}
 	}
 
-	return ret
+	return ret, nil
 }
 
-func print(values map[string]string) {
+func to_string(values map[string]string) string {	// The 81-char line format, with '.' for unsolved squares and '?' for empty ones
+	var ret []byte
 	for y := 0; y < 9; y++ {
-		if y == 3 || y == 6 {
-			fmt.Printf(" ------+-------+------\n")
-		}
 		for x := 0; x < 9; x++ {
-			if x == 3 || x == 6 {
-				fmt.Printf(" |")
-			}
-			s := "?"
+			c := byte('?')
 			if len(values[name[x][y]]) > 1 {
-				s = "."
+				c = '.'
 			} else if len(values[name[x][y]]) == 1 {
-				s = values[name[x][y]]
+				c = values[name[x][y]][0]
 			}
-			fmt.Printf(" %s", s)
+			ret = append(ret, c)
 		}
-		fmt.Printf("\n")
 	}
+	return string(ret)
 }
 
 func validate(values map[string]string) bool {
@@ -347,8 +347,8 @@ func validate(values map[string]string) bool {
 
 	for _, unit := range unitlist {
 		set := make(map[string]bool)
-		for _, d := range unit {
-			set[d] = true
+		for _, s := range unit {
+			set[values[s]] = true
 		}
 		if len(set) != 9 {
 			return false
@@ -358,48 +358,38 @@ func validate(values map[string]string) bool {
 	return true
 }
 
-func main() {
-
-	f, err := ioutil.ReadFile("puzzles.txt")
-
-	if err != nil {
-		panic(err)
-	}
-
-	lines := strings.Split(string(f), "\n")
-
-	puzzle_id := 0
-	var fails []int
-
-	start_time := time.Now()
-
-	for _, line := range lines {
+// ------------------------------------------------------------------------------------------------
 
-		if len(line) < 81 {
-			continue
-		}
+type Solver struct {				// One puzzle, for the batch driver in cmd/sudoku and sudoku.SolveVerified(). The zero value is ready for Parse().
+	values		map[string]string
+	steps		int
+}
 
-		puzzle_id++
-		grid := parse_string(line)
-		fmt.Printf("%d. New puzzle...\n", puzzle_id)
-		print(grid)
+func (self *Solver) Parse(s string) error {	// On ErrContradictoryGivens the puzzle is still kept, for String()
+	values, err := parse_string(s)
+	self.values = values
+	self.steps = 0
+	return err
+}
 
-		solution := search(grid)
-		
-		if solution == nil {
-			fmt.Printf("No solution found!\n")
-			fails = append(fails, puzzle_id)
-		} else if validate(solution) == false {
-			panic("Solution failed validation")
-		} else {
-			fmt.Printf("Solution found...\n")
-			print(solution)
-		}
+func (self *Solver) Solve() bool {			// False if there's no solution, in which case the puzzle is kept
+	self.steps = 0
+	result := search(copy_map(self.values), &self.steps)
+	if result == nil {
+		return false
 	}
+	self.values = result
+	return true
+}
 
-	if len(fails) > 0 {
-		fmt.Printf("\nFailures: %v\n", fails)
-	}
+func (self *Solver) Validate() bool {
+	return validate(self.values)
+}
 
-	fmt.Printf("\nElapsed time: %v\n", time.Now().Sub(start_time))
-}
\ No newline at end of file
+func (self *Solver) String() string {
+	return to_string(self.values)
+}
+
+func (self *Solver) Steps() int {			// The search tree size of the last Solve()
+	return self.steps
+}
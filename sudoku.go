@@ -1,4 +1,4 @@
-package main
+package sudoku
 
 // Sudoku solver with constraint propagation.
 // Loosely inspired by http://norvig.com/sudoku.html
@@ -13,15 +13,26 @@ package main
 // Note: internally we do Sudoku with numbers 0-8. The number nine in puzzles becomes our zero.
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/rooklift/sudoku/norvig"
 )
 
 type Point struct {
-	x		int
-	y		int
+	X		int
+	Y		int
 }
 
 var lookup_units [9][9][][]Point					// Can retrieve the 3 units a cell belongs to.
@@ -29,6 +40,66 @@ var lookup_peers [9][9][]Point						// Can retrieve the 20 peers a cell has.
 
 var all_units [][]Point
 
+func PointToName(p Point) string {					// Norvig-style square names, as in the norvig package: row letter A-I, then column 1-9
+	return fmt.Sprintf("%c%c", "ABCDEFGHI"[p.Y], "123456789"[p.X])
+}
+
+func NameToPoint(name string) (Point, error) {
+	if len(name) != 2 || name[0] < 'A' || name[0] > 'I' || name[1] < '1' || name[1] > '9' {
+		return Point{}, fmt.Errorf("NameToPoint(): bad square name %q", name)
+	}
+	return Point{int(name[1] - '1'), int(name[0] - 'A')}, nil
+}
+
+func unit_name(unit []Point) string {				// e.g. "row 3", counting from 1. Boxes are numbered in reading order.
+	if unit[0].X == unit[8].X {						// Comparing the first and last cells, since a box's first 3 share a column
+		return fmt.Sprintf("column %d", unit[0].X + 1)
+	} else if unit[0].Y == unit[8].Y {
+		return fmt.Sprintf("row %d", unit[0].Y + 1)
+	}
+	return fmt.Sprintf("box %d", BoxIndex(unit[0].X, unit[0].Y) + 1)
+}
+
+func BoxIndex(x, y int) int {						// 0-8, numbering the 3x3 boxes in reading order
+	return (y / 3) * 3 + x / 3
+}
+
+func CellsInBox(box int) []Point {					// The 9 cells of a box, numbered as per BoxIndex()
+	var ret []Point
+	startx := (box % 3) * 3
+	starty := (box / 3) * 3
+	for x := startx; x < startx + 3; x++ {
+		for y := starty; y < starty + 3; y++ {
+			ret = append(ret, Point{x, y})
+		}
+	}
+	return ret
+}
+
+func CellsInBoth(unitA, unitB []Point) []Point {	// The intersection of two units, in unitA's order
+	var ret []Point
+	for _, a := range unitA {
+		for _, b := range unitB {
+			if a == b {
+				ret = append(ret, a)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func digit_to_index(d int) int {					// Internally we use 0 instead of 9
+	return d % 9
+}
+
+func index_to_digit(n int) int {
+	if n == 0 {
+		return 9
+	}
+	return n
+}
+
 // ------------------------------------------------------------------------------------------------
 // Unit lookup tables - a unit is a set of 9 cells. Each cell belongs to 3 units.
 // There are a total of 27 units.
@@ -71,7 +142,7 @@ func build_unit_tables() {
 
 	unit_contains := func(unit []Point, x, y int) bool {		// Helper function
 		for _, point := range unit {
-			if point.x == x && point.y == y {
+			if point.X == x && point.Y == y {
 				return true
 			}
 		}
@@ -112,28 +183,292 @@ func build_peer_tables() {
 				}
 			}
 
-			square_startx := (x / 3) * 3
-			square_starty := (y / 3) * 3
+			for _, point := range CellsInBox(BoxIndex(x, y)) {
+				if point.X != x && point.Y != y {
+					peers = append(peers, point)
+				}
+			}
+
+			lookup_peers[x][y] = peers
+		}
+	}
+}
+
+// ------------------------------------------------------------------------------------------------
+// Topology validation - for variants (jigsaw, diagonal, etc) which supply their own units.
+
+const topology_search_limit = 100000		// Search nodes ValidateTopology() may spend looking for a solution
+
+func ValidateTopology(units [][]Point) error {
+
+	// Check that a set of units makes a proper Sudoku: every unit is 9 distinct cells on the board, all 9 rows
+	// and columns are included, every cell is also in some other unit (its region), and the empty grid has at
+	// least one solution. The last is checked with a bounded search, so a topology which is too awkward to
+	// solve quickly is given the benefit of the doubt.
+
+	var covered [9][9]int
+	var rows, cols [9]bool
+	seen := make(map[[9]Point]bool)
+
+	for i, unit := range units {
+
+		if len(unit) != 9 {
+			return fmt.Errorf("ValidateTopology(): unit %d has %d cells", i, len(unit))
+		}
+
+		in_unit := make(map[Point]bool)
+
+		for _, point := range unit {
+			if point.X < 0 || point.X > 8 || point.Y < 0 || point.Y > 8 {
+				return fmt.Errorf("ValidateTopology(): unit %d has off-board cell %v", i, point)
+			}
+			if in_unit[point] {
+				return fmt.Errorf("ValidateTopology(): unit %d contains %s twice", i, PointToName(point))
+			}
+			in_unit[point] = true
+		}
+
+		var key [9]Point						// The cells in reading order, to spot duplicate units
+		n := 0
+		for y := 0; y < 9; y++ {
+			for x := 0; x < 9; x++ {
+				if in_unit[Point{x, y}] {
+					key[n] = Point{x, y}
+					n++
+				}
+			}
+		}
+
+		if seen[key] {
+			return fmt.Errorf("ValidateTopology(): unit %d is a duplicate", i)
+		}
+		seen[key] = true
+
+		if key[0].Y == key[8].Y {
+			rows[key[0].Y] = true
+		} else if key[0].X == key[8].X {
+			cols[key[0].X] = true
+		} else {
+			for _, point := range unit {
+				covered[point.X][point.Y]++
+			}
+		}
+	}
+
+	for i := 0; i < 9; i++ {
+		if !rows[i] {
+			return fmt.Errorf("ValidateTopology(): row %d is missing", i + 1)
+		}
+		if !cols[i] {
+			return fmt.Errorf("ValidateTopology(): column %d is missing", i + 1)
+		}
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if covered[x][y] == 0 {
+				return fmt.Errorf("ValidateTopology(): %s is only in its row and column", PointToName(Point{x, y}))
+			}
+		}
+	}
+
+	// Look for a solution of the empty grid, using the units' own peer relation...
+
+	var peers [9][9][]Point
+
+	for _, unit := range units {
+		for _, a := range unit {
+			for _, b := range unit {
+				if a != b {
+					peers[a.X][a.Y] = append(peers[a.X][a.Y], b)
+				}
+			}
+		}
+	}
+
+	var values [9][9]int
+	nodes := 0
+
+	var search func() (found bool, complete bool)
+
+	search = func() (bool, bool) {
+
+		nodes++
+		if nodes > topology_search_limit {
+			return false, false
+		}
+
+		best := Point{-1, -1}
+		var best_options []int
 
-			for x3 := square_startx; x3 < square_startx + 3; x3++ {
-				for y3 := square_starty; y3 < square_starty + 3; y3++ {
-					if x3 != x && y3 != y {
-						peers = append(peers, Point{x3, y3})
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				if values[x][y] != 0 {
+					continue
+				}
+				var used [10]bool
+				for _, peer := range peers[x][y] {
+					used[values[peer.X][peer.Y]] = true
+				}
+				var options []int
+				for d := 1; d <= 9; d++ {
+					if !used[d] {
+						options = append(options, d)
 					}
 				}
+				if best.X == -1 || len(options) < len(best_options) {
+					best = Point{x, y}
+					best_options = options
+				}
 			}
+		}
 
-			lookup_peers[x][y] = peers
+		if best.X == -1 {
+			return true, true
+		}
+
+		for _, d := range best_options {
+			values[best.X][best.Y] = d
+			found, complete := search()
+			if found || !complete {
+				return found, complete
+			}
+		}
+
+		values[best.X][best.Y] = 0
+		return false, true
+	}
+
+	if found, complete := search(); complete && !found {
+		return errors.New("ValidateTopology(): the empty grid has no solution")
+	}
+
+	return nil
+}
+
+type topology struct {							// The units and peers of a variant, in the same form as the global tables
+	units			[][]Point
+	lookup_units	[9][9][][]Point
+	lookup_peers	[9][9][]Point
+}
+
+func new_topology(units [][]Point) *topology {
+
+	ret := &topology{units: units}
+
+	for _, unit := range units {
+		for _, point := range unit {
+			ret.lookup_units[point.X][point.Y] = append(ret.lookup_units[point.X][point.Y], unit)
+		}
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			seen := make(map[Point]bool)
+			for _, unit := range ret.lookup_units[x][y] {
+				for _, point := range unit {
+					if point != (Point{x, y}) && seen[point] == false {
+						seen[point] = true
+						ret.lookup_peers[x][y] = append(ret.lookup_peers[x][y], point)
+					}
+				}
+			}
 		}
 	}
+
+	return ret
+}
+
+func StandardUnits() [][]Point {					// The classic 27 units: 9 columns, 9 rows, then 9 boxes. A copy, safe to extend.
+	ret := make([][]Point, len(all_units))
+	for i, unit := range all_units {
+		ret[i] = append([]Point(nil), unit...)
+	}
+	return ret
+}
+
+func DiagonalUnits() [][]Point {					// The units of X-Sudoku: the classic 27, plus the two main diagonals
+	var diag, anti []Point
+	for i := 0; i < 9; i++ {
+		diag = append(diag, Point{i, i})
+		anti = append(anti, Point{8 - i, i})
+	}
+	return append(StandardUnits(), diag, anti)
+}
+
+func NewGridWithUnits(units [][]Point) (*Grid, error) {
+
+	// An empty grid for a variant with its own units (checked with ValidateTopology), e.g. DiagonalUnits().
+	// Propagation, and so all the searches, enforce the grid's units, as do Validate() and IsLegal(). The
+	// human strategies, SolveDLX() and the other helpers which name units still assume the classic ones.
+
+	if err := ValidateTopology(units); err != nil {
+		return nil, err
+	}
+
+	ret := NewGrid()
+	ret.topo = new_topology(units)
+	return ret, nil
+}
+
+func (self *Grid) units() [][]Point {				// The units this grid's propagation enforces
+	if self.topo != nil {
+		return self.topo.units
+	}
+	return all_units
 }
 
+// ------------------------------------------------------------------------------------------------
+// Errors - callers can distinguish these with errors.Is()
+//
+//		- ErrNoSolution: the search found no solution. Returned by SolveUnique(), SolveString(),
+//		  SolveWithConfidence(), SolveVerified(), SolveWithUniquenessProof(), CompleteFromHere(),
+//		  GuessCount(), MaxBacktrackDepth(), SolveHuman(), SolvingPathLength(), Coach(),
+//		  GenerateWithFixedGivens() and CheckAgainstAny().
+//
+//		- ErrMultipleSolutions: the puzzle isn't unique. Returned by SolveUnique(), SolveString(),
+//		  SolveWithConfidence() and SolveVerified().
+//
+//		- ErrContradictoryGivens: the givens conflict before any search. Returned by NewGridFromInts()
+//		  and so by everything built on it - ParseString(), ParseMasked(), ParseRows(), ParseBlock(),
+//		  UnpackSolution(), SolveString(), SolveWithConfidence(), SolveVerified(), LoadPuzzleFile() and
+//		  Builder.Build() - and also by StepOnce(), CompleteFromHere(), SolveHuman(), SolvingPathLength()
+//		  and GenerateWithFixedGivens().
+//
+//		- ErrRequiresGuessing: the human techniques stalled before the grid was solved. Returned by
+//		  SolveHuman(), SolvingPathLength() and Coach(); RequiresGuessing() and Fingerprint() test for it.
+
+var ErrNoSolution = errors.New("no solution")
+var ErrMultipleSolutions = errors.New("multiple solutions")
+var ErrContradictoryGivens = errors.New("contradictory givens")
+var ErrRequiresGuessing = errors.New("requires guessing")
+
 // ------------------------------------------------------------------------------------------------
 // Grid - our main data structure, definition, creation, and validation...
 
 type Grid struct {
 	cells	[9][9][9]bool							// Bools say whether their index is possible for the cell.
-	steps	*int									// How many times Solve() is called. Shared between grids with the same origin.
+	counts	[9][9]int8								// How many of each cell's bools are true. Kept up to date by anything that writes cells.
+	givens	[9][9]int								// The digits (1-9) the puzzle was set up with, or 0 for cells that weren't givens.
+	steps	*int									// How many search nodes were visited. Shared between grids with the same origin.
+	alphabet	[]rune								// The symbols used for 1-9 when printing and parsing, or nil for the usual digits.
+	copies	*int									// If not nil, counts calls to Copy(). Shared like steps. See SolveWithCopyCount().
+	trail	*[]int									// If not nil, Eliminate() logs each candidate it removes here. See SolveInPlace().
+	deductions	*[]Step								// If not nil, each placement is recorded here with its cause. Shared like steps. See StepOnce().
+	topo	*topology								// If not nil, the variant units to use instead of the classic ones. See NewGridWithUnits().
+
+	// The steps pointer is shared by Copy(), so that the search tree size accumulates across all the grids
+	// made during a search, and the solution reports the same total as the grid it came from. Solve() and
+	// the other search entry points start from a fresh counter unless ContinueCounting is set, in which case
+	// the count carries on from wherever it was.
+
+	ContinueCounting	bool
+}
+
+type Clue struct {
+	X		int		`json:"x"`
+	Y		int		`json:"y"`
+	Digit	int		`json:"digit"`					// 1-9, i.e. not our internal representation
 }
 
 func NewGrid() *Grid {
@@ -143,6 +478,7 @@ func NewGrid() *Grid {
 			for n := 0; n < 9; n++ {
 				ret.cells[x][y][n] = true
 			}
+			ret.counts[x][y] = 9
 		}
 	}
 	ret.steps = new(int)
@@ -152,10 +488,79 @@ func NewGrid() *Grid {
 func (self *Grid) Copy() *Grid {
 	ret := new(Grid)
 	ret.cells = self.cells							// This works to copy the cells since we are only using actual arrays (if it was slices it wouldn't work)
+	ret.counts = self.counts
+	ret.givens = self.givens
 	ret.steps = self.steps							// Same pointer
+	ret.alphabet = self.alphabet
+	ret.ContinueCounting = self.ContinueCounting
+	ret.deductions = self.deductions
+	ret.topo = self.topo
+	if self.copies != nil {
+		*self.copies++
+		ret.copies = self.copies
+	}
 	return ret										
 }
 
+func (self *Grid) Clone() *Grid {
+
+	// Like Copy(), but fully independent of the original: the step count is copied into a new counter rather
+	// than shared, so the clone can be searched (e.g. by another goroutine) without the two affecting each
+	// other's counts. The givens and alphabet are copied too.
+
+	ret := self.Copy()
+	ret.steps = new(int)
+	*ret.steps = *self.steps
+	ret.alphabet = append([]rune(nil), self.alphabet...)	// Stays nil if it was nil
+	return ret
+}
+
+func (self *Grid) Transpose() *Grid {				// A new grid with x and y swapped for every cell. The result is still a valid Sudoku.
+	ret := NewGrid()
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			ret.set_cell(y, x, self.cells[x][y])
+			ret.givens[y][x] = self.givens[x][y]
+		}
+	}
+	if self.topo != nil {							// Variant units are transposed too (X-Sudoku's diagonals map to themselves)
+		var units [][]Point
+		for _, unit := range self.topo.units {
+			var foo []Point
+			for _, point := range unit {
+				foo = append(foo, Point{point.Y, point.X})
+			}
+			units = append(units, foo)
+		}
+		ret.topo = new_topology(units)
+	}
+	ret.alphabet = self.alphabet
+	ret.ContinueCounting = self.ContinueCounting
+	return ret
+}
+
+func (self *Grid) Steps() int {						// The size of the last search tree, as counted by the counter this grid shares with its copies
+	return *self.steps
+}
+
+func (self *Grid) ResetSteps() {					// Give this grid a fresh counter. Grids previously copied from it keep the old one.
+	self.steps = new(int)
+}
+
+type Checkpoint struct {							// An opaque snapshot of a grid's state, for Restore(). Safe to copy.
+	cells	[9][9][9]bool
+	givens	[9][9]int
+}
+
+func (self *Grid) Checkpoint() Checkpoint {
+	return Checkpoint{self.cells, self.givens}
+}
+
+func (self *Grid) Restore(c Checkpoint) {			// Put the candidates and givens back as they were at the checkpoint
+	self.set_cells(c.cells)
+	self.givens = c.givens
+}
+
 func (self *Grid) Validate() bool {					// Complete test of whether the solution is valid. Only used for sanity checking, not during search.
 
 	for x := 0; x < 9; x++ {
@@ -166,12 +571,33 @@ func (self *Grid) Validate() bool {					// Complete test of whether the solution
 		}
 	}
 
+	_, _, ok := self.CheckConsistency()			// With every cell solved, no duplicates means each unit has all 9 digits
+	return ok
+}
+
+func (self *Grid) CheckConsistency() ([]Point, int, bool) {
+
+	// For partly-filled grids, e.g. to flag a player's bad entry: the first unit (of the grid's own units,
+	// as per NewGridWithUnits) where two solved cells hold the same digit, with that digit (1-9). Unsolved
+	// cells are never a conflict. Returns true, with no unit, if there's no conflict.
+
+	for _, unit := range self.units() {
+		if digit, dup := self.UnitHasDuplicate(unit); dup {
+			return append([]Point(nil), unit...), digit, false
+		}
+	}
+
+	return nil, 0, true
+}
+
+func units_complete(values [9][9]int) bool {		// Whether every unit holds each of 1-9 exactly once
+
 	for _, unit := range all_units {
 		set := make(map[int]bool)
 		for _, point := range unit {
-			set[self.Value(point.x, point.y)] = true
+			set[values[point.X][point.Y]] = true
 		}
-		if len(set) != 9 {
+		if len(set) != 9 || set[0] {
 			return false
 		}
 	}
@@ -179,17 +605,65 @@ func (self *Grid) Validate() bool {					// Complete test of whether the solution
 	return true
 }
 
+func ValidateString(s string) (bool, error) {		// Check a fully-filled 81-char grid without building a solver grid
+
+	var values [9][9]int
+	i := 0
+
+	for _, c := range s {
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		if c < '1' || c > '9' {
+			return false, fmt.Errorf("ValidateString(): bad cell %q at position %d", c, i)
+		}
+		if i < 81 {
+			values[i % 9][i / 9] = int(c) - 48
+		}
+		i++
+	}
+
+	if i != 81 {
+		return false, fmt.Errorf("ValidateString(): got %d cells, expected 81", i)
+	}
+
+	return units_complete(values), nil
+}
+
 // ------------------------------------------------------------------------------------------------
 // Grid - manipulation and solving...
 
-func (self *Grid) Count(x, y int) int {				// The number of possibles at x,y - maybe optimise this away later
-	ret := 0
-	for n := 0; n < 9; n++ {
-		if self.cells[x][y][n] {
-			ret++
+func (self *Grid) Count(x, y int) int {				// The number of possibles at x,y
+	return int(self.counts[x][y])
+}
+
+// Anything that changes cells other than through Eliminate() must go through one of these, to keep the
+// counts right. None of them do any propagation.
+
+func (self *Grid) set_cell(x, y int, cell [9]bool) {
+	self.cells[x][y] = cell
+	self.counts[x][y] = int8(count_marks(cell))
+}
+
+func (self *Grid) set_cells(cells [9][9][9]bool) {
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			self.set_cell(x, y, cells[x][y])
 		}
 	}
-	return ret
+}
+
+func (self *Grid) set_only(x, y, val int) {			// Make val the only possible at x,y. Unlike Set(), nothing else changes.
+	self.cells[x][y] = [9]bool{}
+	self.cells[x][y][val] = true
+	self.counts[x][y] = 1
+}
+
+func (self *Grid) remove_possible(x, y, val int) {	// Unlike Eliminate(), nothing else changes
+	if self.cells[x][y][val] {
+		self.cells[x][y][val] = false
+		self.counts[x][y]--
+	}
 }
 
 func (self *Grid) Value(x, y int) int {				// The value locked in to x,y, only valid iff Count(x,y) == 1
@@ -211,248 +685,4949 @@ func (self *Grid) Possibles(x, y int) []int {		// List of all possible values fo
 	return ret
 }
 
-func (self *Grid) Set(x, y, val int) {
-	if self.cells[x][y][val] == false {
-		panic("Set() tried to set a value already ruled out")
+func (self *Grid) Candidates(x, y int) []int {		// As Possibles(), but as digits 1-9 in increasing order, e.g. for drawing pencil marks
+	var ret []int
+	for d := 1; d <= 9; d++ {
+		if self.cells[x][y][digit_to_index(d)] {
+			ret = append(ret, d)
+		}
 	}
-	for n := 0; n < 9; n++ {
-		if n != val {
-			self.Eliminate(x, y, n)
+	return ret
+}
+
+func (self *Grid) AllCandidates() [9][9][]int {		// Candidates() for every cell, indexed [x][y]
+	var ret [9][9][]int
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			ret[x][y] = self.Candidates(x, y)
 		}
 	}
+	return ret
 }
 
-func (self *Grid) Eliminate(x, y, val int) {
+func (self *Grid) UnitHasDuplicate(unit []Point) (int, bool) {	// A digit (1-9) held by two solved cells of the unit, if any. Cheaper than Validate().
+	var seen [9]bool
+	for _, point := range unit {
+		if self.Count(point.X, point.Y) == 1 {
+			n := self.Value(point.X, point.Y)
+			if seen[n] {
+				return index_to_digit(n), true
+			}
+			seen[n] = true
+		}
+	}
+	return 0, false
+}
 
-	if self.cells[x][y][val] == false {
-		return
+func (self *Grid) MissingDigits(unit []Point) []int {	// The digits 1-9 not yet in a solved cell of the unit, in increasing order
+	var present [9]bool
+	for _, point := range unit {
+		if self.Count(point.X, point.Y) == 1 {
+			present[self.Value(point.X, point.Y)] = true
+		}
+	}
+	ret := []int{}
+	for d := 1; d <= 9; d++ {
+		if !present[digit_to_index(d)] {
+			ret = append(ret, d)
+		}
 	}
+	return ret
+}
 
-	self.cells[x][y][val] = false
+func (self *Grid) CandidatesByName() map[string][]int {	// Square name (as per PointToName) --> candidate digits 1-9 in increasing order
 
-	// Norvig strategy #1...
-	// If the cell now has only 1 value, it is fixed here and must be removed from all the peers...
+	ret := make(map[string][]int)
+	marks := self.marks()
 
-	if self.Count(x, y) == 1 {
-		fixed_value := self.Value(x, y)
-		peers := lookup_peers[x][y]
-		for _, peer := range peers {
-			self.Eliminate(peer.x, peer.y, fixed_value)
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			var digits []int
+			for d := 1; d <= 9; d++ {
+				if marks[x][y][digit_to_index(d)] {
+					digits = append(digits, d)
+				}
+			}
+			ret[PointToName(Point{x, y})] = digits
 		}
 	}
 
-	// Norvig strategy #2...
-	// For each unit containing x,y, the elimination may have forced val into some other square (if it's val's last option)
+	return ret
+}
 
-	units := lookup_units[x][y]
+func (self *Grid) MatchesCandidates(expected map[string][]int) (bool, []string) {
 
-	for _, unit := range units {
+	// Grade a student's pencil marks (square name --> digits 1-9, in any order) against CandidatesByName().
+	// Every unsolved cell must be present and correct; solved cells are only checked if included. Returns
+	// the names of the squares which differ, in reading order.
 
-		options := 0
-		for _, point := range unit {
-			if self.cells[point.x][point.y][val] {
-				options++
+	actual := self.CandidatesByName()
+	var diffs []string
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+
+			name := PointToName(Point{x, y})
+			claimed, ok := expected[name]
+
+			if !ok {
+				if len(actual[name]) != 1 {
+					diffs = append(diffs, name)
+				}
+				continue
 			}
-		}
 
-		if options == 1 {
-			for _, point := range unit {						// Find it again! Could optimise this away.
-				if self.cells[point.x][point.y][val] {
-					if self.Count(point.x, point.y) > 1 {		// i.e. this cell wasn't already solved
-						self.Set(point.x, point.y, val)
-					}
+			var want, got [10]bool
+			for _, d := range actual[name] {
+				want[d] = true
+			}
+			for _, d := range claimed {
+				if d >= 1 && d <= 9 {
+					got[d] = true
+				} else {
+					got[0] = true			// Nonsense digit, so it can't match
 				}
 			}
+
+			if want != got {
+				diffs = append(diffs, name)
+			}
 		}
 	}
+
+	return len(diffs) == 0, diffs
 }
 
-func (self *Grid) Solve() *Grid {					// Returns the solved grid, or nil if there was no solution
+func (self *Grid) Impossibles(x, y int) []int {		// The digits 1-9 which x,y can no longer be, in increasing order. Note: digits, unlike Possibles().
+	var ret []int
+	for d := 1; d <= 9; d++ {
+		if self.cells[x][y][digit_to_index(d)] == false {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
 
-	*self.steps++
+func (self *Grid) UnitsOf(x, y int) (row, col, box []Point) {	// The 3 units of x,y, labelled by kind
+	units := lookup_units[x][y]						// In the order build_unit_tables() made them: column, row, box
+	return units[1], units[0], units[2]
+}
 
-	x_index := -1
-	y_index := -1
-	got_above_one := false
-	lowest_above_one := 999
+func (self *Grid) PeersWithValue(x, y, val int) []Point {	// The peers of x,y already solved as the digit val (1-9), e.g. to explain a conflict
+	if val < 1 || val > 9 {
+		panic("PeersWithValue() called with invalid digit")
+	}
+	n := digit_to_index(val)
+	var ret []Point
+	for _, peer := range lookup_peers[x][y] {
+		if self.Count(peer.X, peer.Y) == 1 && self.cells[peer.X][peer.Y][n] {
+			ret = append(ret, peer)
+		}
+	}
+	return ret
+}
 
-	// Some counting of possibilities in cells...
-	// If we need to search, we find the cell with the smallest number of possibles so we can test each in turn.
+func (self *Grid) Peers(x, y int) []Point {			// The 20 cells which share a unit with x,y
+	return append([]Point(nil), lookup_peers[x][y]...)	// A copy, so callers can't damage the lookup table
+}
 
+func ArePeers(a, b Point) bool {					// Whether a and b are different cells in the same unit
+	return sees(a, b)
+}
+
+func (self *Grid) PercentComplete() float64 {		// The fraction (0-1) of the 81 cells which are solved
+	solved := 0
 	for x := 0; x < 9; x++ {
 		for y := 0; y < 9; y++ {
-			count := self.Count(x, y)
-			if count == 0 {
-				return nil							// We have a cell with zero possibles - grid is illegal
+			if self.Count(x, y) == 1 {
+				solved++
 			}
-			if count > 1 {
-				got_above_one = true
-				if count < lowest_above_one {
-					lowest_above_one = count
-					x_index = x
-					y_index = y
+		}
+	}
+	return float64(solved) / 81
+}
+
+func (self *Grid) Entropy() float64 {				// Remaining uncertainty: the sum of log2(Count()) over the cells, so 0 when solved
+	ret := 0.0
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if count := self.Count(x, y); count > 1 {
+				ret += math.Log2(float64(count))
+			}
+		}
+	}
+	return ret
+}
+
+func (self *Grid) Bitsets() [81]uint16 {			// Candidates per cell in row-major order (index y * 9 + x). Bit d - 1 is set if digit d is possible.
+	var ret [81]uint16
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			for n := 0; n < 9; n++ {
+				if self.cells[x][y][n] {
+					ret[y * 9 + x] |= 1 << uint(index_to_digit(n) - 1)
 				}
 			}
 		}
 	}
+	return ret
+}
 
-	if !got_above_one {								// Every cell has exactly 1 possible - the puzzle is solved
-		return self
+func (self *Grid) SolvableWithoutSearch() bool {	// Whether propagation (e.g. from SetFromString) has already solved every cell, legally
+	x, _, legal := self.branch_point()
+	return legal && x == -1 && self.Validate()
+}
+
+func (self *Grid) DigitCounts() [10]int {			// How many solved cells hold each digit 1-9, with index 0 counting the unsolved cells
+	var ret [10]int
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 1 {
+				ret[index_to_digit(self.Value(x, y))]++
+			} else {
+				ret[0]++
+			}
+		}
+	}
+	return ret
+}
+
+func (self *Grid) HardestBox() (int, int) {		// The box (as per BoxIndex) with the most unsolved cells, and that count. Ties go to the lowest box.
+	best, best_count := 0, -1
+	for box := 0; box < 9; box++ {
+		count := 0
+		for _, point := range CellsInBox(box) {
+			if self.Count(point.X, point.Y) > 1 {
+				count++
+			}
+		}
+		if count > best_count {
+			best, best_count = box, count
+		}
 	}
+	return best, best_count
+}
 
-	// Try each possible for the chosen x,y in turn...
+func (self *Grid) CountGrid() [9][9]int {			// Count() for every cell, indexed [x][y] like everything else
+	var ret [9][9]int
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			ret[x][y] = self.Count(x, y)
+		}
+	}
+	return ret
+}
 
-	possibles := self.Possibles(x_index, y_index)
+func (self *Grid) BiValueCells() []Point {			// Every cell with exactly 2 possibles
+	var ret []Point
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 2 {
+				ret = append(ret, Point{x, y})
+			}
+		}
+	}
+	return ret
+}
 
-	for _, n := range possibles {
-		foo := self.Copy()
-		foo.Set(x_index, y_index, n)
-		result := foo.Solve()
-		if result != nil {
-			return result
+func (self *Grid) CandidateCells(val int) []Point {	// Every cell (solved or not) where the digit val (1-9) is still possible
+	if val < 1 || val > 9 {
+		panic("CandidateCells() called with invalid digit")
+	}
+	n := digit_to_index(val)
+	var ret []Point
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.cells[x][y][n] {
+				ret = append(ret, Point{x, y})
+			}
 		}
 	}
+	return ret
+}
+
+func (self *Grid) SetDigit(x, y, digit int) error {
+
+	// The friendly version of Set(): digit is 1-9 as people write it, not our internal 0-8 (where 9 is
+	// stored as 0). Errors instead of panicking if the input is out of range or the digit is ruled out.
+
+	if x < 0 || x > 8 || y < 0 || y > 8 {
+		return fmt.Errorf("SetDigit(): bad cell %d,%d", x, y)
+	}
 
+	if digit < 1 || digit > 9 {
+		return fmt.Errorf("SetDigit(): bad digit %d", digit)
+	}
+
+	n := digit_to_index(digit)
+
+	if self.cells[x][y][n] == false {
+		return fmt.Errorf("SetDigit(): %s can't be %d", PointToName(Point{x, y}), digit)
+	}
+
+	self.Set(x, y, n)
 	return nil
 }
 
-// ------------------------------------------------------------------------------------------------
-// Grid - utility methods...
+func (self *Grid) Set(x, y, val int) {				// val is internal (0-8, with 0 meaning 9) - see SetDigit() for digits 1-9
+	if self.cells[x][y][val] == false {
+		panic("Set() tried to set a value already ruled out")
+	}
+	for n := 0; n < 9; n++ {
+		if n != val {
+			self.Eliminate(x, y, n)
+		}
+	}
+}
 
-func (self *Grid) Print() {
-	for y := 0; y < 9; y++ {
-		if y == 3 || y == 6 {
-			fmt.Printf(" ------+-------+------\n")
+func (self *Grid) Eliminate(x, y, val int) {
+
+	if self.cells[x][y][val] == false {
+		return
+	}
+
+	self.cells[x][y][val] = false
+	self.counts[x][y]--
+
+	if self.trail != nil {
+		*self.trail = append(*self.trail, x * 81 + y * 9 + val)
+	}
+
+	// Norvig strategy #1...
+	// If the cell now has only 1 value, it is fixed here and must be removed from all the peers...
+
+	if self.Count(x, y) == 1 {
+		fixed_value := self.Value(x, y)
+		if self.deductions != nil {
+			self.log_placement("naked single", x, y, fixed_value)
 		}
-		for x := 0; x < 9; x++ {
-			if x == 3 || x == 6 {
-				fmt.Printf(" |")
+		peers := lookup_peers[x][y]
+		if self.topo != nil {
+			peers = self.topo.lookup_peers[x][y]
+		}
+		for _, peer := range peers {
+			self.Eliminate(peer.X, peer.Y, fixed_value)
+		}
+	}
+
+	// Norvig strategy #2...
+	// For each unit containing x,y, the elimination may have forced val into some other square (if it's val's last option)
+
+	units := lookup_units[x][y]
+	if self.topo != nil {
+		units = self.topo.lookup_units[x][y]
+	}
+
+	for _, unit := range units {
+
+		options := 0
+		for _, point := range unit {
+			if self.cells[point.X][point.Y][val] {
+				options++
 			}
-			s := "?"								// Used if no values found for the cell
-			for n := 0; n < 9; n++ {
-				if self.cells[x][y][n] {
-					if s == "?" {					// This is the first possible seen
-						s = fmt.Sprintf("%d", n)
-						if s == "0" {
-							s = "9"					// Internally we use 0 instead of 9
+		}
+
+		if options == 1 {
+			for _, point := range unit {						// Find it again! Could optimise this away.
+				if self.cells[point.X][point.Y][val] {
+					if self.Count(point.X, point.Y) > 1 {		// i.e. this cell wasn't already solved
+						if self.deductions != nil {
+							self.log_placement("hidden single", point.X, point.Y, val)
 						}
-					} else {						// We have seen 2 or more possibles, so we'll display "."
-						s = "."
+						self.Set(point.X, point.Y, val)
 					}
 				}
 			}
-			fmt.Printf(" %s", s)
 		}
-		fmt.Printf("\n")
 	}
 }
 
-func (self *Grid) SetFromString(s string) {
+func (self *Grid) log_placement(technique string, x, y, val int) {
 
-	var numbers []int
+	// Record a placement in the deductions log, unless x,y has one already. Needed because placing a hidden
+	// single (or a guess) leaves the cell with one candidate, which Eliminate() would otherwise report again
+	// as a naked single.
 
-	for _, c := range s {
-		if c == '.' || c == '0' {
-			numbers = append(numbers, -1)
-		} else if c >= '1' && c <= '9' {
-			numbers = append(numbers, int(c) - 48)
+	for _, step := range *self.deductions {
+		if step.X == x && step.Y == y && !step.Eliminated {
+			return
 		}
 	}
+	*self.deductions = append(*self.deductions, Step{technique, x, y, index_to_digit(val), false})
+}
 
-	if len(numbers) != 81 {
-		panic("Bad puzzle string")
+func (self *Grid) StepOnce() ([]Step, error) {
+
+	// Constraint propagation only, with no guessing, reporting what it does: the givens (or the solved
+	// cells, if there are no givens) are set on a fresh grid and every placement this forces is returned
+	// in order, as a "naked single" (a cell left with one candidate) or a "hidden single" (a digit left with
+	// one place in a unit). The receiver is not modified. Errors if the givens are contradictory.
+
+	foo := NewGrid()
+	foo.alphabet = self.alphabet
+	log := make([]Step, 0, 81)
+	foo.deductions = &log
+
+	values := self.puzzle_values()
+
+	for x := 0; x < 9; x++ {						// Log the givens first, so nothing is reported as deducing them
+		for y := 0; y < 9; y++ {
+			if values[x][y] != 0 {
+				foo.log_placement("given", x, y, digit_to_index(values[x][y]))
+			}
+		}
 	}
 
 	for x := 0; x < 9; x++ {
 		for y := 0; y < 9; y++ {
-			index := y * 9 + x
-			if numbers[index] <= 0 {
-				continue
-			} else if numbers[index] == 9 {			// Internally we use 0 instead of 9
-				self.Set(x, y, 0)
-			} else {
-				self.Set(x, y, numbers[index])
+			if values[x][y] != 0 {
+				val := digit_to_index(values[x][y])
+				if foo.cells[x][y][val] == false {
+					return nil, ErrContradictoryGivens
+				}
+				foo.Set(x, y, val)
 			}
 		}
 	}
-}
-
-// ------------------------------------------------------------------------------------------------
-
-func init() {
-	build_unit_tables()
-	build_peer_tables()
 
-	if len(all_units) != 27 {
-		panic("all_units invalid")
+	if _, _, legal := foo.branch_point(); !legal {
+		return nil, ErrContradictoryGivens
 	}
-	for _, unit := range all_units {
-		if len(unit) != 9 {
-			panic("unit invalid")
+
+	var ret []Step
+	for _, step := range log {
+		if step.Technique != "given" {
+			ret = append(ret, step)
 		}
 	}
+	return ret, nil
+}
+
+func (self *Grid) branch_point() (int, int, bool) {		// The cell to search on next, or -1,-1 if solved. False if the grid is illegal.
+
+	x_index := -1
+	y_index := -1
+	lowest_above_one := 999
+
+	// Some counting of possibilities in cells...
+	// If we need to search, we find the cell with the smallest number of possibles so we can test each in turn.
+
 	for x := 0; x < 9; x++ {
 		for y := 0; y < 9; y++ {
-			if len(lookup_peers[x][y]) != 20 {
-				panic("peer list invalid")
-			}
-			if len(lookup_units[x][y]) != 3 {
-				panic("unit list invalid")
+			count := self.Count(x, y)
+			if count == 0 {
+				return -1, -1, false				// We have a cell with zero possibles - grid is illegal
 			}
-			for _, unit := range lookup_units[x][y] {
-				if len(unit) != 9 {
-					panic("unit invalid")
+			if count > 1 {
+				if count < lowest_above_one {
+					lowest_above_one = count
+					x_index = x
+					y_index = y
 				}
 			}
 		}
 	}
+
+	return x_index, y_index, true
 }
 
-func main() {
+func (self *Grid) Solve() *Grid {					// Returns the solved grid, or nil if there was no solution
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+	return self.solve_context(context.Background(), 0)
+}
 
-	f, err := ioutil.ReadFile("puzzles.txt")
+func (self *Grid) SolveContext(ctx context.Context) *Grid {	// As Solve(), but returns nil once ctx is done. Check ctx.Err() to tell that from no solution.
+	return self.SolveWithMaxSteps(ctx, 0)
+}
 
-	if err != nil {
-		panic(err)
+func (self *Grid) SolveWithMaxSteps(ctx context.Context, maxSteps int) *Grid {
+
+	// As SolveContext(), but also gives up (returning nil) once the search has visited more than maxSteps
+	// nodes, as counted by Steps(). maxSteps <= 0 means no cap. With ContinueCounting the cap applies to
+	// this search alone, not the running total.
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
 	}
 
-	lines := strings.Split(string(f), "\n")
+	limit := 0
+	if maxSteps > 0 {
+		limit = *self.steps + maxSteps
+	}
 
-	puzzle_id := 0
-	var fails []int
+	return self.solve_context(ctx, limit)
+}
 
-	start_time := time.Now()
+func (self *Grid) solve_context(ctx context.Context, limit int) *Grid {	// As solve(), but stopping when ctx is done or *steps passes limit (if > 0)
 
-	for _, line := range lines {
+	if ctx.Done() == nil && limit <= 0 {			// Can't be cancelled, e.g. context.Background()
+		return self.solve()
+	}
 
-		if len(line) < 81 {
-			continue
-		}
+	return self.run(&search{
+		visit: func(g *Grid, depth int) bool {
+			return (limit <= 0 || *g.steps <= limit) && ctx.Err() == nil
+		},
+	}, 0)
+}
 
-		puzzle_id++
-		grid := NewGrid()
-		grid.SetFromString(line)
-		fmt.Printf("%d. New puzzle...\n", puzzle_id)
-		grid.Print()
+func (self *Grid) SolveWithDeductions() (*Grid, []Step) {
 
-		solution := grid.Solve()
-		
-		if solution == nil {
-			fmt.Printf("No solution found! (search tree size was %d)\n", *grid.steps)
-			fails = append(fails, puzzle_id)
-		} else if solution.Validate() == false {
-			panic("Solution failed validation")
-		} else {
-			fmt.Printf("Solution found... (search tree size was %d)\n", *solution.steps)
-			solution.Print()
-		}
+	// As Solve(), also returning the placements made on the way from the receiver's current state to the
+	// solution, as per StepOnce(), with each value the search tried and kept recorded as a "guess". Branches
+	// that failed are left out. Returns nil, nil if there's no solution.
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
 	}
 
-	if len(fails) > 0 {
-		fmt.Printf("\nFailures: %v\n", fails)
+	foo := self.Copy()
+	log := make([]Step, 0, 81)
+	foo.deductions = &log
+
+	solution := foo.run(&search{
+		branch: func(g *Grid, p Point, val int) (*Grid, func()) {
+			mark := len(*g.deductions)
+			child := g.Copy()
+			child.log_placement("guess", p.X, p.Y, val)
+			return child, func() {
+				*g.deductions = (*g.deductions)[:mark]		// Failed branches are left out
+			}
+		},
+	}, 0)
+
+	if solution == nil {
+		return nil, nil
 	}
 
-	fmt.Printf("\nElapsed time: %v\n", time.Now().Sub(start_time))
+	solution.deductions = nil
+	return solution, log
+}
+
+func (self *Grid) SolveWithPairs() *Grid {
+
+	// As Solve(), but at every search node the pairs strategies (see EliminatePairs) run before the cell to
+	// branch on is chosen. Each node costs more, but the tree is smaller. Their eliminations go through
+	// Eliminate(), so the usual propagation follows from them.
 
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+	return self.Copy().run(&search{
+		visit: func(g *Grid, depth int) bool {
+			if _, _, legal := g.branch_point(); legal {		// Pairs can't be trusted on a broken grid
+				g.EliminatePairs()
+			}
+			return true
+		},
+	}, 0)
 }
 
+func (self *Grid) SolveInPlace() *Grid {
+
+	// As Solve(), with the same search order and results, but working on a single grid. Rather than copying
+	// the grid at each branch, every elimination is logged, and on backtracking the log is unwound to put
+	// the removed candidates back. The receiver is not modified.
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+
+	foo := self.Copy()
+	trail := make([]int, 0, 1024)
+	foo.trail = &trail
+
+	result := foo.run(&search{
+		branch: func(g *Grid, p Point, val int) (*Grid, func()) {
+			mark := len(*g.trail)
+			return g, func() {
+				for i := len(*g.trail) - 1; i >= mark; i-- {		// Undo everything since the mark
+					entry := (*g.trail)[i]
+					g.cells[entry / 81][(entry / 9) % 9][entry % 9] = true
+					g.counts[entry / 81][(entry / 9) % 9]++
+				}
+				*g.trail = (*g.trail)[:mark]
+			}
+		},
+	}, 0)
+
+	if result == nil {
+		return nil
+	}
+
+	foo.trail = nil
+	return foo
+}
+
+func (self *Grid) SolveWithCopyCount() (*Grid, int) {	// As Solve(), also returning how many grids the search copied
+
+	foo := self.Copy()
+	copies := 0
+	foo.copies = &copies
+
+	if !foo.ContinueCounting {
+		foo.ResetSteps()
+	}
+
+	result := foo.solve()
+
+	if result != nil {
+		result.copies = nil							// Stop counting once we're done
+	}
+
+	return result, copies
+}
+
+func (self *Grid) solve() *Grid {
+	return self.run(new(search), 0)
+}
+
+// ------------------------------------------------------------------------------------------------
+// The depth first search itself. Every search method is run() with its own hooks, apart from the one step at
+// a time Search, which shares choose(), and SolveDLX(), which is a different algorithm.
+
+type search struct {
+	pick		func(g *Grid) (Point, []int)				// Chooses the cell to branch on and the order to try its values. Nil for DefaultPick().
+	visit		func(g *Grid, depth int) bool				// Called at each node, once counted in *steps. Returning false abandons the search.
+	branch		func(g *Grid, p Point, val int) (*Grid, func())	// The grid to try val at p in (before it's set), and how to undo that if it fails. Nil for Copy().
+	found		func(g *Grid) bool							// Called with each solution. Returning true carries on looking for more. Nil to stop at the first.
+	abandoned	bool
+}
+
+func (self *Grid) run(s *search, depth int) *Grid {	// The solution the search stopped at, or nil
+
+	*self.steps++
+
+	if s.visit != nil && s.visit(self, depth) == false {
+		s.abandoned = true
+		return nil
+	}
+
+	point, values, legal := self.choose(s.pick)
+
+	if !legal {
+		return nil
+	}
+
+	if point.X == -1 {								// Every cell has exactly 1 possible - the puzzle is solved
+		if s.found != nil && s.found(self) {
+			return nil
+		}
+		return self
+	}
+
+	// Try each value for the chosen cell in turn...
+
+	for _, n := range values {
+
+		if self.cells[point.X][point.Y][n] == false {
+			continue
+		}
+
+		var foo *Grid
+		var undo func()
+
+		if s.branch != nil {
+			foo, undo = s.branch(self, point, n)
+		} else {
+			foo = self.Copy()
+		}
+
+		foo.Set(point.X, point.Y, n)
+
+		result := foo.run(s, depth + 1)
+		if result != nil || s.abandoned {
+			return result
+		}
+
+		if undo != nil {
+			undo()
+		}
+	}
+
+	return nil
+}
+
+func (self *Grid) choose(pick func(*Grid) (Point, []int)) (Point, []int, bool) {
+
+	// The cell to branch on and the values to try there, as per pick (nil for DefaultPick). The point is -1,-1
+	// if the grid is solved, and false is returned if it's illegal.
+
+	x_index, y_index, legal := self.branch_point()
+
+	if !legal {
+		return Point{}, nil, false
+	}
+
+	if x_index == -1 {
+		return Point{-1, -1}, nil, true
+	}
+
+	if pick == nil {
+		return Point{x_index, y_index}, self.Possibles(x_index, y_index), true
+	}
+
+	point, values := pick(self)
+
+	if self.Count(point.X, point.Y) < 2 {
+		panic("SolveFunc() pick function returned a solved cell")
+	}
+
+	return point, values, true
+}
+
+// SearchNode is one node of the search tree recorded by SolveWithTree(). Apart from the root (which has X and Y
+// of -1 and Digit 0) each node is a guess of Digit at X,Y, made at its parent. Succeeded is true along the path
+// to the solution.
+
+type SearchNode struct {
+	X			int				`json:"x"`
+	Y			int				`json:"y"`
+	Digit		int				`json:"digit"`			// 1-9, i.e. not our internal representation
+	Succeeded	bool			`json:"succeeded"`
+	Children	[]*SearchNode	`json:"children,omitempty"`
+}
+
+func (self *Grid) SolveWithTree() (*Grid, *SearchNode) {		// As Solve(), also recording the search tree. Slower, so kept separate.
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+
+	root := &SearchNode{X: -1, Y: -1}
+	nodes := map[*Grid]*SearchNode{self: root}
+	parents := make(map[*SearchNode]*SearchNode)
+
+	solution := self.run(&search{
+		branch: func(g *Grid, p Point, val int) (*Grid, func()) {
+			child := g.Copy()
+			node := &SearchNode{X: p.X, Y: p.Y, Digit: index_to_digit(val)}
+			nodes[g].Children = append(nodes[g].Children, node)
+			nodes[child] = node
+			parents[node] = nodes[g]
+			return child, nil
+		},
+		found: func(g *Grid) bool {
+			for node := nodes[g]; node != nil; node = parents[node] {
+				node.Succeeded = true
+			}
+			return false
+		},
+	}, 0)
+
+	return solution, root
+}
+
+// Search is the same depth-first search as Solve(), but driven one node at a time by the caller, so it can be
+// paused and resumed at will. The pending nodes are kept on an explicit stack instead of the Go call stack.
+
+type Search struct {
+	pending		[]*Grid							// Nodes still to visit, the next one last
+	result		*Grid
+	done		bool
+}
+
+func (self *Grid) NewSearch() *Search {			// The receiver is not modified. Resets its step count, as Solve() does.
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+	return &Search{pending: []*Grid{self.Copy()}}
+}
+
+func (self *Search) Step() bool {				// Visit one node. Returns false once the search is over.
+
+	if self.done {
+		return false
+	}
+
+	if len(self.pending) == 0 {
+		self.done = true
+		return false
+	}
+
+	grid := self.pending[len(self.pending) - 1]
+	self.pending = self.pending[:len(self.pending) - 1]
+
+	*grid.steps++
+
+	point, values, legal := grid.choose(nil)		// As run() does, but with the children kept on a stack rather than recursed into
+
+	if legal && point.X == -1 {
+		self.result = grid
+		self.pending = nil
+		self.done = true
+		return false
+	}
+
+	if legal {
+		for i := len(values) - 1; i >= 0; i-- {		// Pushed in reverse so they're visited in the same order as run()
+			foo := grid.Copy()
+			foo.Set(point.X, point.Y, values[i])
+			self.pending = append(self.pending, foo)
+		}
+	}
+
+	if len(self.pending) == 0 {
+		self.done = true
+		return false
+	}
+
+	return true
+}
+
+func (self *Search) Result() *Grid {			// The solution, or nil if there is none or the search isn't over yet
+	return self.result
+}
+
+// Search the whole tree rather than stopping at the first solution. onFound (if not nil) is called with each
+// solution found; the search stops early if it returns false, or once max solutions are found (max <= 0 for
+// no limit). Returns the number of solutions found. The receiver is not modified.
+
+func (self *Grid) EnumerateSolutions(max int, onFound func(*Grid) bool) int {
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+
+	count := 0
+
+	self.Copy().run(&search{
+		found: func(g *Grid) bool {
+			count++
+			if onFound != nil && onFound(g) == false {
+				return false
+			}
+			return max <= 0 || count < max
+		},
+	}, 0)
+
+	return count
+}
+
+func DefaultPick(g *Grid) (Point, []int) {			// The policy Solve() uses: the cell with fewest possibles, tried in numeric order
+	x, y, _ := g.branch_point()
+	return Point{x, y}, g.Possibles(x, y)
+}
+
+func (self *Grid) SolveFunc(pick func(*Grid) (Point, []int)) *Grid {
+
+	// As Solve(), but at each search node pick() chooses the cell to branch on, and the order to try its
+	// values in (internal values, as per Possibles). It's only called on legal grids with unsolved cells,
+	// and must return an unsolved cell. Values that aren't possible there are skipped.
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+	return self.run(&search{pick: pick}, 0)
+}
+
+func (self *Grid) SolveRandom(r *rand.Rand) *Grid {	// As Solve() but trying the possibles in random order, e.g. to make varied solution grids
+	return self.SolveFunc(func(g *Grid) (Point, []int) {
+		point, possibles := DefaultPick(g)
+		r.Shuffle(len(possibles), func(i, j int) {
+			possibles[i], possibles[j] = possibles[j], possibles[i]
+		})
+		return point, possibles
+	})
+}
+
+func (self *Grid) SolveAnnotated() (*Grid, [9][9]int) {
+
+	// Solve, also returning how each cell was determined: 0 for givens (or the solved cells, if the grid
+	// has no givens recorded), 1 for cells forced by logic alone (propagation plus the extra strategies),
+	// and 2 for cells which needed the search. Returns nil if there's no solution.
+
+	var ret [9][9]int
+
+	foo := self.Copy()
+	for foo.ApplyLockedCandidates() > 0 || foo.EliminateXYWing() || foo.EliminateColoring() {}
+
+	no_givens := len(self.Givens()) == 0
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.IsGiven(x, y) || (no_givens && self.Count(x, y) == 1) {
+				ret[x][y] = 0
+			} else if foo.Count(x, y) == 1 {
+				ret[x][y] = 1
+			} else {
+				ret[x][y] = 2
+			}
+		}
+	}
+
+	solution := foo.Solve()
+
+	if solution == nil {
+		return nil, [9][9]int{}
+	}
+
+	return solution, ret
+}
+
+func (self *Grid) SolveWithOrder() (*Grid, [9][9]int) {
+
+	// Solve, also returning when each cell was solved: 0 for givens (or the solved cells, if the grid has no
+	// givens recorded), then 1, 2, 3... in the order they became solved. This replays the puzzle from its
+	// givens, then along the search's successful path. Cells solved by the same placement are numbered in
+	// reading order. Returns nil if there's no solution.
+
+	var ret [9][9]int
+	var solved [9][9]bool
+
+	values := self.puzzle_values()
+	grid := NewGrid()
+	order := 0
+
+	record := func() {
+		for y := 0; y < 9; y++ {
+			for x := 0; x < 9; x++ {
+				if !solved[x][y] && grid.Count(x, y) == 1 {
+					solved[x][y] = true
+					order++
+					ret[x][y] = order
+				}
+			}
+		}
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			solved[x][y] = values[x][y] != 0
+		}
+	}
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if values[x][y] == 0 {
+				continue
+			}
+			n := digit_to_index(values[x][y])
+			if grid.cells[x][y][n] == false {
+				return nil, [9][9]int{}
+			}
+			grid.Set(x, y, n)
+			record()
+		}
+	}
+
+	solution := grid.Copy()
+	solution.ResetSteps()
+	solution = solution.solve()
+
+	if solution == nil {
+		return nil, [9][9]int{}
+	}
+
+	for {
+		x, y, _ := grid.branch_point()
+		if x == -1 {
+			break
+		}
+		grid.Set(x, y, solution.Value(x, y))		// As the search did, on the path that worked
+		record()
+	}
+
+	return solution, ret
+}
+
+func (self *Grid) WhyUnsolvable() (Point, string, error) {
+
+	// Explain why there's no solution. If propagation alone has produced a contradiction, report it: either
+	// a cell with no possibles, or a unit where some value has nowhere to go (then the point is -1,-1). If
+	// the contradiction only appears during the search, say so. Errors if the grid actually has a solution.
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 0 {
+				return Point{x, y}, fmt.Sprintf("cell %s has no possible values", PointToName(Point{x, y})), nil
+			}
+		}
+	}
+
+	for _, unit := range all_units {
+		for n := 0; n < 9; n++ {
+			places := 0
+			for _, point := range unit {
+				if self.cells[point.X][point.Y][n] {
+					places++
+				}
+			}
+			if places == 0 {
+				return Point{-1, -1}, fmt.Sprintf("no cell in %s can hold %s", unit_name(unit), self.symbol(index_to_digit(n))), nil
+			}
+		}
+	}
+
+	if self.IsSolvable() {
+		return Point{-1, -1}, "", errors.New("WhyUnsolvable(): grid has a solution")
+	}
+
+	return Point{-1, -1}, "no contradiction without guessing; every guess leads to one", nil
+}
+
+const conflict_search_limit = 1000			// Search nodes MinimalConflictSet() may spend proving each candidate set unsolvable
+
+func (self *Grid) MinimalConflictSet() ([]Point, bool) {
+
+	// For an unsolvable grid, find a subset of its solved cells which can't coexist, such that dropping any one
+	// of them would remove the contradiction. To keep this tractable, a set only counts as a conflict if a search
+	// of at most conflict_search_limit nodes proves it unsolvable. Returns false if the solved cells can't be
+	// shown to conflict (including when the grid is unsolvable only because of eliminations).
+
+	values := self.Values()
+
+	conflicts := func(values [9][9]int) bool {
+		foo := NewGrid()
+		if foo.set_values(values) != nil {
+			return true
+		}
+		found, complete := foo.search_bounded(conflict_search_limit)
+		return complete && !found
+	}
+
+	if !conflicts(values) {
+		return nil, false
+	}
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if values[x][y] == 0 {
+				continue
+			}
+			digit := values[x][y]
+			values[x][y] = 0
+			if !conflicts(values) {
+				values[x][y] = digit				// Needed after all
+			}
+		}
+	}
+
+	var ret []Point
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if values[x][y] != 0 {
+				ret = append(ret, Point{x, y})
+			}
+		}
+	}
+
+	return ret, true
+}
+
+func (self *Grid) search_bounded(limit int) (found bool, complete bool) {	// Like solve(), but gives up after limit nodes. Resets the receiver's step count.
+	s := &search{
+		visit: func(g *Grid, depth int) bool {
+			return *g.steps <= limit
+		},
+	}
+	self.ResetSteps()
+	found = self.run(s, 0) != nil
+	return found, !s.abandoned
+}
+
+func (self *Grid) GuessCount() (int, error) {		// How many values the search tried in multi-candidate cells before finding the solution
+
+	foo := self.Copy()
+	foo.ResetSteps()
+
+	if foo.solve() == nil {
+		return 0, ErrNoSolution
+	}
+
+	return *foo.steps - 1, nil						// Every search node but the root comes from a guess
+}
+
+func (self *Grid) Merge(other *Grid) (*Grid, error) {
+
+	// A new grid with the solved cells of both, e.g. to combine two players' progress. Starts from a copy of
+	// the receiver (so keeps its givens) and places the other grid's solved cells, with the usual propagation.
+	// Errors if the grids disagree about a cell, or if together their placements lead to a contradiction.
+
+	ret := self.Copy()
+	mine := self.Values()
+	theirs := other.Values()
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if mine[x][y] != 0 && theirs[x][y] != 0 && mine[x][y] != theirs[x][y] {
+				return nil, fmt.Errorf("Merge(): grids disagree at %s", PointToName(Point{x, y}))
+			}
+		}
+	}
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if theirs[x][y] == 0 {
+				continue
+			}
+			n := digit_to_index(theirs[x][y])
+			if ret.cells[x][y][n] == false {			// Including where propagation already solved it as something else
+				return nil, fmt.Errorf("Merge(): %s can't be %d once the placements are combined", PointToName(Point{x, y}), theirs[x][y])
+			}
+			ret.Set(x, y, n)
+		}
+	}
+
+	if _, _, legal := ret.branch_point(); !legal {
+		return nil, errors.New("Merge(): the combined placements contradict each other")
+	}
+
+	return ret, nil
+}
+
+func (self *Grid) RandomValidMove(r *rand.Rand) (Point, int, bool) {
+
+	// For auto-play: a random unsolved cell and its digit (1-9) in the solution. Returns false if the grid
+	// is already solved, or doesn't have a unique solution to take the move from.
+
+	var unsolved []Point
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) > 1 {
+				unsolved = append(unsolved, Point{x, y})
+			}
+		}
+	}
+
+	if len(unsolved) == 0 {
+		return Point{}, 0, false
+	}
+
+	solution, err := self.Copy().SolveUnique()
+
+	if err != nil {
+		return Point{}, 0, false
+	}
+
+	p := unsolved[r.Intn(len(unsolved))]
+	return p, index_to_digit(solution.Value(p.X, p.Y)), true
+}
+
+const uniqueness_search_limit = 1000000			// Search nodes SolveWithUniquenessProof() may visit
+
+func (self *Grid) SolveWithUniquenessProof() (*Grid, bool, error) {
+
+	// Solve, then carry on searching to prove there's no second solution. Returns the (first) solution and
+	// whether it's unique. Returns ErrNoSolution if there's none, or the solution with an error if the search
+	// hit uniqueness_search_limit nodes before the proof was complete.
+
+	foo := self.Copy()
+	foo.ResetSteps()
+
+	solutions, complete := foo.enumerate_bounded(2, uniqueness_search_limit)
+
+	if len(solutions) == 0 {
+		if !complete {
+			return nil, false, errors.New("SolveWithUniquenessProof(): search limit reached")
+		}
+		return nil, false, ErrNoSolution
+	}
+
+	if len(solutions) > 1 {
+		return solutions[0], false, nil
+	}
+
+	if !complete {
+		return solutions[0], false, errors.New("SolveWithUniquenessProof(): search limit reached before uniqueness was proved")
+	}
+
+	return solutions[0], true, nil
+}
+
+func (self *Grid) enumerate_bounded(max, limit int) ([]*Grid, bool) {	// Up to max solutions, and false if the node limit ended the search. Resets the receiver's step count.
+
+	var solutions []*Grid
+
+	s := &search{
+		visit: func(g *Grid, depth int) bool {
+			return *g.steps <= limit
+		},
+		found: func(g *Grid) bool {
+			solutions = append(solutions, g)
+			return len(solutions) < max
+		},
+	}
+
+	self.ResetSteps()
+	self.run(s, 0)
+	return solutions, !s.abandoned
+}
+
+func (self *Grid) MaxBacktrackDepth() (int, error) {	// The deepest nesting of guesses the search reached, 0 if it needed none
+
+	foo := self.Copy()
+	foo.ResetSteps()
+
+	deepest := 0
+
+	if foo.solve_depth(&deepest) == nil {
+		return deepest, ErrNoSolution
+	}
+
+	return deepest, nil
+}
+
+type Stats struct {								// Measurements of one search, from SolveWithStats()
+	Steps			int				`json:"steps"`		// Search tree size, as per Steps()
+	Guesses			int				`json:"guesses"`		// Values tried in multi-candidate cells, as per GuessCount()
+	MaxDepth		int				`json:"max_depth"`	// As per MaxBacktrackDepth()
+	Propagated		int				`json:"propagated"`	// Cells solved by propagation alone before the first guess, givens excluded
+	Elapsed			time.Duration	`json:"-"`			// Durations don't read well as JSON; SolveResult has time_ms instead
+}
+
+func (self *Grid) SolveWithStats() (*Grid, Stats) {	// As Solve(), also measuring the search. Stats are still filled in if there's no solution.
+
+	var stats Stats
+	start := time.Now()
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+	before := *self.steps
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 1 && self.IsGiven(x, y) == false {
+				stats.Propagated++
+			}
+		}
+	}
+
+	result := self.Copy().solve_depth(&stats.MaxDepth)
+
+	stats.Steps = *self.steps - before
+	stats.Guesses = stats.Steps - 1					// Every search node but the root comes from a guess
+	stats.Elapsed = time.Now().Sub(start)
+
+	return result, stats
+}
+
+func (self *Grid) solve_depth(deepest *int) *Grid {	// As solve(), tracking the depth
+	return self.run(&search{
+		visit: func(g *Grid, depth int) bool {
+			if depth > *deepest {
+				*deepest = depth
+			}
+			return true
+		},
+	}, 0)
+}
+
+func (self *Grid) EliminateAndSolve(x, y, val int) *Grid {	// Solve a copy with val (internal, as per Eliminate) ruled out at x,y. Nil if that leaves no solution.
+	foo := self.Copy()
+	foo.Eliminate(x, y, val)
+	return foo.Solve()
+}
+
+func (self *Grid) WithForbidden(forbidden map[Point][]int) *Grid {
+
+	// A copy with the listed digits (1-9) ruled out of each cell, with the usual propagation, e.g. to layer
+	// a variant's extra constraints over the normal rules. The result may be illegal if they're too much.
+
+	ret := self.Copy()
+
+	for p, digits := range forbidden {
+		for _, d := range digits {
+			if d < 1 || d > 9 {
+				panic("WithForbidden() got a digit outside 1-9")
+			}
+			ret.Eliminate(p.X, p.Y, digit_to_index(d))
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) TryEliminations(elims []struct{ P Point; Val int }) bool {
+
+	// Apply each elimination (Val is internal, as per Eliminate) with the usual propagation. If the batch
+	// empties any cell, the grid is restored to exactly how it was beforehand and false is returned.
+
+	snapshot := self.cells
+	counts := self.counts
+
+	for _, e := range elims {
+		self.Eliminate(e.P.X, e.P.Y, e.Val)
+	}
+
+	if _, _, legal := self.branch_point(); !legal {
+		self.cells = snapshot
+		self.counts = counts
+		return false
+	}
+
+	return true
+}
+
+func (self *Grid) Implications(x, y, val int) ([]Step, bool) {
+
+	// The consequences of supposing x,y is val (internal, as per Set): on a copy, set it and log what the
+	// propagation eliminates, in order, as "propagation" steps - with a placement step whenever a cell is
+	// left with one candidate. Returns false (with the steps up to that point) if it leads to a contradiction,
+	// including if val is already ruled out.
+
+	if self.cells[x][y][val] == false {
+		return nil, false
+	}
+
+	foo := self.Copy()
+	trail := make([]int, 0, 256)
+	foo.trail = &trail
+	foo.Set(x, y, val)
+
+	var ret []Step
+	replay := self.Copy()
+	replay.set_cell(x, y, foo.cells[x][y])				// The hypothesis itself isn't a step
+
+	for _, entry := range trail {
+		x2, y2, n := entry / 81, (entry / 9) % 9, entry % 9
+		if x2 == x && y2 == y {
+			continue
+		}
+		replay.remove_possible(x2, y2, n)
+		ret = append(ret, Step{"propagation", x2, y2, index_to_digit(n), true})
+		if replay.Count(x2, y2) == 1 {
+			ret = append(ret, Step{"propagation", x2, y2, index_to_digit(replay.Value(x2, y2)), false})
+		} else if replay.Count(x2, y2) == 0 {
+			return ret, false
+		}
+	}
+
+	_, _, legal := foo.branch_point()
+	return ret, legal
+}
+
+func (self *Grid) ForcedAfter(x, y, val int) (int, bool) {
+
+	// How many other cells become solved if x,y is set to val (internal, as per Set) and the consequences
+	// propagated. Works on a copy. Returns false if val is already ruled out or leads to a contradiction.
+
+	if self.cells[x][y][val] == false {
+		return 0, false
+	}
+
+	foo := self.Copy()
+	before := count_clues(foo.Values())
+	if foo.Count(x, y) > 1 {
+		before++								// Don't count x,y itself
+	}
+
+	foo.Set(x, y, val)
+
+	if _, _, legal := foo.branch_point(); !legal {
+		return 0, false
+	}
+
+	return count_clues(foo.Values()) - before, true
+}
+
+func (self *Grid) CompleteFromHere() (*Grid, error) {
+
+	// "Solve the rest" for a game in progress: every solved cell, given or played, is kept, and the search
+	// fills in the others. Errors if two solved cells already clash or a cell has no candidates left
+	// (ErrContradictoryGivens), or if the player's entries leave no solution (ErrNoSolution).
+
+	for _, unit := range self.units() {
+		if _, dup := self.UnitHasDuplicate(unit); dup {
+			return nil, ErrContradictoryGivens
+		}
+	}
+
+	if _, _, legal := self.branch_point(); !legal {
+		return nil, ErrContradictoryGivens
+	}
+
+	foo := self.Copy()
+	foo.ResetSteps()
+	solution := foo.solve()
+
+	if solution == nil {
+		return nil, ErrNoSolution
+	}
+
+	return solution, nil
+}
+
+func (self *Grid) IsLegal() bool {
+
+	// A quick check, without any search, that the current state isn't already a dead end: every cell has
+	// a candidate, and every digit still has somewhere to go in every unit. (Eliminate() only acts when a
+	// digit is down to one place, so the latter can fail even when branch_point() is happy.)
+
+	if _, _, legal := self.branch_point(); !legal {
+		return false
+	}
+
+	for _, unit := range self.units() {
+		for n := 0; n < 9; n++ {
+			home := false
+			for _, point := range unit {
+				if self.cells[point.X][point.Y][n] {
+					home = true
+					break
+				}
+			}
+			if !home {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (self *Grid) IsSolvable() bool {				// Whether at least one solution exists. Searches on a copy; the receiver (and its step count) is untouched.
+	foo := self.Copy()
+	foo.ResetSteps()
+	return foo.solve() != nil
+}
+
+func (self *Grid) CountSolutions(limit int) int {	// Solutions found, stopping at limit (e.g. 2 to test uniqueness). The receiver and its step count are untouched.
+	foo := self.Copy()
+	foo.ResetSteps()
+	return foo.EnumerateSolutions(limit, nil)
+}
+
+func (self *Grid) SolveUnique() (*Grid, error) {	// Returns the solution, or ErrNoSolution / ErrMultipleSolutions
+
+	var solution *Grid
+
+	count := self.EnumerateSolutions(2, func(g *Grid) bool {
+		solution = g
+		return true
+	})
+
+	if count == 0 {
+		return nil, ErrNoSolution
+	} else if count > 1 {
+		return nil, ErrMultipleSolutions
+	}
+	return solution, nil
+}
+
+func (self *Grid) SolutionCountEstimate(r *rand.Rand, sampleLimit int) int {
+
+	// Estimate the number of solutions, for grids with too many to enumerate, using Knuth's estimator: each
+	// sample walks one random path down the search tree, multiplying together the number of live branches
+	// at each node, and scores that product if the path ends in a solution (0 otherwise). The mean over
+	// sampleLimit samples is unbiased, but the variance is large - expect it to be out by a factor of a few
+	// for small sample counts, and use EnumerateSolutions() where an exact answer is feasible. The result is
+	// capped at the largest int. The paths are chosen with r. The receiver is not modified.
+
+	if sampleLimit <= 0 {
+		return 0
+	}
+
+	total := 0.0
+
+	for i := 0; i < sampleLimit; i++ {
+
+		grid := self.Copy()
+		product := 1.0
+
+		for {
+			x, y, legal := grid.branch_point()
+			if !legal {
+				product = 0
+				break
+			}
+			if x == -1 {
+				break
+			}
+			var branches []*Grid
+			for _, n := range grid.Possibles(x, y) {
+				foo := grid.Copy()
+				foo.Set(x, y, n)
+				if _, _, legal := foo.branch_point(); legal {
+					branches = append(branches, foo)
+				}
+			}
+			if len(branches) == 0 {
+				product = 0
+				break
+			}
+			product *= float64(len(branches))
+			grid = branches[r.Intn(len(branches))]
+		}
+
+		total += product
+	}
+
+	estimate := total / float64(sampleLimit)
+
+	if estimate + 0.5 >= float64(math.MaxInt) {		// Converting anything out of range to int is undefined
+		return math.MaxInt
+	}
+
+	return int(estimate + 0.5)
+}
+
+// ------------------------------------------------------------------------------------------------
+// Alternative solver - Knuth's Algorithm X with dancing links. Sudoku is an exact cover problem: each
+// candidate (x, y, n) is a row covering 4 of 324 constraint columns (cell x,y is filled, and row y,
+// column x, and the box each contain n). Rows are only made for candidates the grid still allows.
+
+type dlx struct {
+	left		[]int								// Node 0 is the root, nodes 1..324 are the column headers
+	right		[]int
+	up			[]int
+	down		[]int
+	col			[]int								// The column header of each node
+	row			[]int								// The candidate each node belongs to, as x * 81 + y * 9 + n
+	size		[]int								// For column headers, the number of nodes in the column
+	solution	[]int
+}
+
+func new_dlx(columns int) *dlx {
+	d := new(dlx)
+	for i := 0; i <= columns; i++ {
+		d.left = append(d.left, i - 1)
+		d.right = append(d.right, i + 1)
+		d.up = append(d.up, i)
+		d.down = append(d.down, i)
+		d.col = append(d.col, i)
+		d.row = append(d.row, -1)
+		d.size = append(d.size, 0)
+	}
+	d.left[0] = columns
+	d.right[columns] = 0
+	return d
+}
+
+func (d *dlx) add_row(row int, columns []int) {
+	first := len(d.left)
+	for i, c := range columns {
+		node := len(d.left)
+		d.left = append(d.left, node - 1)
+		d.right = append(d.right, first)
+		d.up = append(d.up, d.up[c])
+		d.down = append(d.down, c)
+		d.col = append(d.col, c)
+		d.row = append(d.row, row)
+		d.size = append(d.size, 0)
+		d.down[d.up[c]] = node
+		d.up[c] = node
+		d.size[c]++
+		if i == 0 {
+			d.left[node] = first + len(columns) - 1
+		} else {
+			d.right[node - 1] = node
+		}
+	}
+}
+
+func (d *dlx) cover(c int) {
+	d.right[d.left[c]] = d.right[c]
+	d.left[d.right[c]] = d.left[c]
+	for i := d.down[c]; i != c; i = d.down[i] {
+		for j := d.right[i]; j != i; j = d.right[j] {
+			d.down[d.up[j]] = d.down[j]
+			d.up[d.down[j]] = d.up[j]
+			d.size[d.col[j]]--
+		}
+	}
+}
+
+func (d *dlx) uncover(c int) {
+	for i := d.up[c]; i != c; i = d.up[i] {
+		for j := d.left[i]; j != i; j = d.left[j] {
+			d.size[d.col[j]]++
+			d.down[d.up[j]] = j
+			d.up[d.down[j]] = j
+		}
+	}
+	d.right[d.left[c]] = c
+	d.left[d.right[c]] = c
+}
+
+func (d *dlx) search(steps *int) bool {			// Leaves the chosen rows in d.solution if it returns true
+
+	*steps++
+
+	if d.right[0] == 0 {
+		return true
+	}
+
+	c := d.right[0]									// Choose the column with the fewest rows, like Solve() does with cells
+	for j := d.right[c]; j != 0; j = d.right[j] {
+		if d.size[j] < d.size[c] {
+			c = j
+		}
+	}
+
+	d.cover(c)
+
+	for r := d.down[c]; r != c; r = d.down[r] {
+		d.solution = append(d.solution, d.row[r])
+		for j := d.right[r]; j != r; j = d.right[j] {
+			d.cover(d.col[j])
+		}
+		if d.search(steps) {
+			return true
+		}
+		for j := d.left[r]; j != r; j = d.left[j] {
+			d.uncover(d.col[j])
+		}
+		d.solution = d.solution[:len(d.solution) - 1]
+	}
+
+	d.uncover(c)
+	return false
+}
+
+func (self *Grid) SolveDLX() *Grid {				// As Solve(), but searching with dancing links. Step counts aren't comparable with Solve()'s.
+
+	if !self.ContinueCounting {
+		self.ResetSteps()
+	}
+
+	d := new_dlx(324)
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			for n := 0; n < 9; n++ {
+				if self.cells[x][y][n] {
+					box := BoxIndex(x, y)
+					d.add_row(x * 81 + y * 9 + n, []int{1 + x * 9 + y, 82 + y * 9 + n, 163 + x * 9 + n, 244 + box * 9 + n})
+				}
+			}
+		}
+	}
+
+	if d.search(self.steps) == false {
+		return nil
+	}
+
+	ret := self.Copy()
+
+	for _, row := range d.solution {
+		x := row / 81
+		y := (row / 9) % 9
+		ret.set_only(x, y, row % 9)
+	}
+
+	return ret
+}
+
+// ------------------------------------------------------------------------------------------------
+// Grid - human-style solving. Norvig's propagation is too eager to show the individual deductions a
+// person would make, so here we work on a "pencil grid" which holds only the placed digits, and the
+// candidates of an unsolved cell are its possibles minus whatever its solved peers hold. Detectors are
+// read-only and report everything of their kind that is currently available, as a list of Steps.
+
+type Step struct {
+	Technique	string	`json:"technique"`
+	X			int		`json:"x"`
+	Y			int		`json:"y"`
+	Digit		int		`json:"digit"`					// 1-9, i.e. not our internal representation
+	Eliminated	bool	`json:"eliminated"`				// If true, Digit was eliminated from X,Y - otherwise it was placed there
+}
+
+type strategy struct {
+	name		string
+	find		func(*Grid) []Step
+}
+
+var human_strategies = []strategy{						// In order of difficulty
+	{"full house", (*Grid).FullHouses},
+	{"naked single", (*Grid).find_naked_singles},
+	{"hidden single", (*Grid).find_hidden_singles},
+	{"locked candidates", (*Grid).find_locked_candidates},
+	{"naked pair", (*Grid).find_naked_pairs},
+	{"hidden pair", (*Grid).find_hidden_pairs},
+	{"x-wing", (*Grid).FindXWings},
+	{"xy-wing", (*Grid).find_xy_wing},
+	{"swordfish", (*Grid).FindSwordfish},
+	{"coloring", (*Grid).find_coloring},
+}
+
+type StrategySet uint								// A choice of human strategies, as a bitmask
+
+const (
+	StrategyFullHouse	StrategySet = 1 << iota			// Same order as human_strategies
+	StrategyNakedSingle
+	StrategyHiddenSingle
+	StrategyLockedCandidates
+	StrategyNakedPair
+	StrategyHiddenPair
+	StrategyXWing
+	StrategyXYWing
+	StrategySwordfish
+	StrategyColoring
+
+	StrategyAll			StrategySet = 1 << iota - 1
+)
+
+func sees(a, b Point) bool {							// Whether two different cells are peers
+	if a == b {
+		return false
+	}
+	return a.X == b.X || a.Y == b.Y || BoxIndex(a.X, a.Y) == BoxIndex(b.X, b.Y)
+}
+
+func (self *Grid) marks() [9][9][9]bool {				// The candidates of every cell, as described above
+
+	ret := self.cells
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) != 1 {
+				continue
+			}
+			val := self.Value(x, y)
+			for _, peer := range lookup_peers[x][y] {
+				if self.Count(peer.X, peer.Y) > 1 {
+					ret[peer.X][peer.Y][val] = false
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) pencil_grid() *Grid {					// A grid holding only the givens (or the solved cells, if there are no givens)
+
+	ret := NewGrid()
+	ret.givens = self.givens
+	ret.steps = self.steps
+
+	values := self.puzzle_values()
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			digit := values[x][y]
+			if digit != 0 {
+				ret.set_only(x, y, digit_to_index(digit))
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) apply_step(step Step) {				// Apply a step without any propagation
+	n := digit_to_index(step.Digit)
+	if step.Eliminated {
+		self.remove_possible(step.X, step.Y, n)
+	} else {
+		self.set_only(step.X, step.Y, n)
+	}
+}
+
+func (self *Grid) FullHouses() []Step {			// Units with one unsolved cell left, which must take the missing digit
+
+	var ret []Step
+
+	for _, unit := range all_units {
+
+		var present [9]bool
+		var empty []Point
+
+		for _, point := range unit {
+			if self.Count(point.X, point.Y) == 1 {
+				present[self.Value(point.X, point.Y)] = true
+			} else {
+				empty = append(empty, point)
+			}
+		}
+
+		if len(empty) != 1 {
+			continue
+		}
+
+		for n := 0; n < 9; n++ {
+			if present[n] == false {
+				ret = append(ret, Step{"full house", empty[0].X, empty[0].Y, index_to_digit(n), false})
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) find_naked_singles() []Step {			// Unsolved cells with only one candidate
+
+	var ret []Step
+	marks := self.marks()
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 1 {
+				continue
+			}
+			count := 0
+			val := 0
+			for n := 0; n < 9; n++ {
+				if marks[x][y][n] {
+					count++
+					val = n
+				}
+			}
+			if count == 1 {
+				ret = append(ret, Step{"naked single", x, y, index_to_digit(val), false})
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) find_hidden_singles() []Step {		// Digits with only one possible place in a unit. A cell may be reported once per unit.
+
+	var ret []Step
+	marks := self.marks()
+
+	for _, unit := range all_units {
+		for n := 0; n < 9; n++ {
+			if place, ok := self.hidden_single(unit, n, &marks); ok {
+				ret = append(ret, Step{"hidden single", place.X, place.Y, index_to_digit(n), false})
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) HiddenSinglesForDigit(d int) []Step {	// As find_hidden_singles(), but only for digit d (1-9)
+
+	if d < 1 || d > 9 {
+		panic("HiddenSinglesForDigit() called with invalid digit")
+	}
+
+	var ret []Step
+	marks := self.marks()
+	n := digit_to_index(d)
+
+	for _, unit := range all_units {
+		if place, ok := self.hidden_single(unit, n, &marks); ok {
+			ret = append(ret, Step{"hidden single", place.X, place.Y, d, false})
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) hidden_single(unit []Point, n int, marks *[9][9][9]bool) (Point, bool) {	// The unsolved cell which is n's only place in the unit, if any
+	places := 0
+	var place Point
+	for _, point := range unit {
+		if marks[point.X][point.Y][n] {
+			places++
+			place = point
+		}
+	}
+	return place, places == 1 && self.Count(place.X, place.Y) > 1
+}
+
+func (self *Grid) find_locked_candidates() []Step {
+
+	// Where a box meets a row or column, if a digit's candidates in the box all lie in the line, the digit
+	// can be removed from the rest of the line ("pointing"); if its candidates in the line all lie in the
+	// box, it can be removed from the rest of the box ("claiming"). Both are checked in one sweep.
+
+	var ret []Step
+	seen := make(map[Step]bool)
+	marks := self.marks()
+
+	for box := 0; box < 9; box++ {
+
+		box_cells := CellsInBox(box)
+
+		for _, line := range all_units[:18] {			// Columns and rows
+
+			in_line := make(map[Point]bool)
+			for _, point := range line {
+				in_line[point] = true
+			}
+
+			if len(CellsInBoth(box_cells, line)) == 0 {
+				continue
+			}
+
+			for n := 0; n < 9; n++ {
+
+				inside := 0
+				var box_rest, line_rest []Point
+
+				for _, point := range box_cells {
+					if marks[point.X][point.Y][n] && self.Count(point.X, point.Y) > 1 {
+						if in_line[point] {
+							inside++
+						} else {
+							box_rest = append(box_rest, point)
+						}
+					}
+				}
+
+				for _, point := range line {
+					if marks[point.X][point.Y][n] && self.Count(point.X, point.Y) > 1 && BoxIndex(point.X, point.Y) != box {
+						line_rest = append(line_rest, point)
+					}
+				}
+
+				if inside < 2 {
+					continue								// Nothing here, or a hidden single
+				}
+
+				var targets []Point
+				if len(box_rest) == 0 {
+					targets = line_rest
+				} else if len(line_rest) == 0 {
+					targets = box_rest
+				}
+
+				for _, point := range targets {
+					step := Step{"locked candidates", point.X, point.Y, index_to_digit(n), true}
+					if seen[step] == false {
+						seen[step] = true
+						ret = append(ret, step)
+					}
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) find_naked_pairs() []Step {
+
+	// Two unsolved cells in a unit with the same two candidates must hold those two digits between them,
+	// so the digits can be removed from the rest of the unit.
+
+	var ret []Step
+	seen := make(map[Step]bool)
+	marks := self.marks()
+
+	for _, unit := range all_units {
+
+		var pairs []Point
+		for _, point := range unit {
+			if self.Count(point.X, point.Y) > 1 && count_marks(marks[point.X][point.Y]) == 2 {
+				pairs = append(pairs, point)
+			}
+		}
+
+		for i := 0; i < len(pairs); i++ {
+			for j := i + 1; j < len(pairs); j++ {
+
+				a, b := pairs[i], pairs[j]
+				if marks[a.X][a.Y] != marks[b.X][b.Y] {
+					continue
+				}
+
+				for _, point := range unit {
+					if point == a || point == b || self.Count(point.X, point.Y) == 1 {
+						continue
+					}
+					for n := 0; n < 9; n++ {
+						if marks[a.X][a.Y][n] && marks[point.X][point.Y][n] {
+							step := Step{"naked pair", point.X, point.Y, index_to_digit(n), true}
+							if seen[step] == false {
+								seen[step] = true
+								ret = append(ret, step)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) find_hidden_pairs() []Step {
+
+	// Two digits which, in some unit, can only go in the same two cells must take those cells between them,
+	// so every other candidate can be removed from the two cells.
+
+	var ret []Step
+	seen := make(map[Step]bool)
+	marks := self.marks()
+
+	for _, unit := range all_units {
+
+		var places [9][]Point
+		for n := 0; n < 9; n++ {
+			for _, point := range unit {
+				if marks[point.X][point.Y][n] && self.Count(point.X, point.Y) > 1 {
+					places[n] = append(places[n], point)
+				}
+			}
+		}
+
+		for n := 0; n < 9; n++ {
+			for m := n + 1; m < 9; m++ {
+
+				if len(places[n]) != 2 || len(places[m]) != 2 || places[n][0] != places[m][0] || places[n][1] != places[m][1] {
+					continue
+				}
+
+				for _, point := range places[n] {
+					for k := 0; k < 9; k++ {
+						if k != n && k != m && marks[point.X][point.Y][k] {
+							step := Step{"hidden pair", point.X, point.Y, index_to_digit(k), true}
+							if seen[step] == false {
+								seen[step] = true
+								ret = append(ret, step)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func count_marks(cell [9]bool) int {				// How many candidates are set in one cell's marks
+	count := 0
+	for _, b := range cell {
+		if b {
+			count++
+		}
+	}
+	return count
+}
+
+func (self *Grid) FindXWings() []Step {			// Fish of size 2; see find_fish()
+	return self.find_fish(2, "x-wing")
+}
+
+func (self *Grid) FindSwordfish() []Step {			// Fish of size 3; see find_fish()
+	return self.find_fish(3, "swordfish")
+}
+
+func (self *Grid) find_fish(size int, technique string) []Step {
+
+	// If in some set of size rows, a digit's candidates all lie within the same size columns, then those rows
+	// must supply the digit for each of those columns, so it can be removed from the columns' other cells.
+	// Likewise with rows and columns swapped. Read-only: the steps are reported, not applied.
+
+	var ret []Step
+	seen := make(map[Step]bool)
+	marks := self.marks()
+
+	for _, transposed := range []bool{false, true} {
+
+		cell := func(line, i int) Point {			// Cell i of base line number line
+			if transposed {
+				return Point{line, i}
+			}
+			return Point{i, line}
+		}
+
+		for n := 0; n < 9; n++ {
+
+			var lines []int							// Base lines with 2 to size candidates for n
+			var spots [9][9]bool					// [line][i] - whether cell i of the line can be n
+
+			for line := 0; line < 9; line++ {
+				count := 0
+				for i := 0; i < 9; i++ {
+					p := cell(line, i)
+					if marks[p.X][p.Y][n] && self.Count(p.X, p.Y) > 1 {
+						spots[line][i] = true
+						count++
+					}
+				}
+				if count >= 2 && count <= size {
+					lines = append(lines, line)
+				}
+			}
+
+			combinations(len(lines), size, func(indices []int) bool {
+
+				var base [9]bool
+				var cover [9]bool
+				covered := 0
+
+				for _, index := range indices {
+					base[lines[index]] = true
+					for i := 0; i < 9; i++ {
+						if spots[lines[index]][i] && !cover[i] {
+							cover[i] = true
+							covered++
+						}
+					}
+				}
+
+				if covered != size {
+					return true
+				}
+
+				for line := 0; line < 9; line++ {
+					if base[line] {
+						continue
+					}
+					for i := 0; i < 9; i++ {
+						p := cell(line, i)
+						if cover[i] && marks[p.X][p.Y][n] && self.Count(p.X, p.Y) > 1 {
+							step := Step{technique, p.X, p.Y, index_to_digit(n), true}
+							if seen[step] == false {
+								seen[step] = true
+								ret = append(ret, step)
+							}
+						}
+					}
+				}
+
+				return true
+			})
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) find_xy_wing() []Step {
+
+	// A pivot cell with candidates {X,Y} which sees two "pincer" cells with candidates {X,Z} and {Y,Z}.
+	// Whichever value the pivot takes, one of the pincers must be Z, so any cell seeing both pincers can't be Z.
+
+	var ret []Step
+	marks := self.marks()
+
+	var pairs []Point
+	var pair_values = make(map[Point][2]int)
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 1 {
+				continue
+			}
+			var values []int
+			for n := 0; n < 9; n++ {
+				if marks[x][y][n] {
+					values = append(values, n)
+				}
+			}
+			if len(values) == 2 {
+				pairs = append(pairs, Point{x, y})
+				pair_values[Point{x, y}] = [2]int{values[0], values[1]}
+			}
+		}
+	}
+
+	eliminated := make(map[Step]bool)				// Don't report the same elimination twice
+
+	for _, pivot := range pairs {
+
+		px := pair_values[pivot][0]
+		py := pair_values[pivot][1]
+
+		for _, a := range pairs {
+
+			if sees(pivot, a) == false {
+				continue
+			}
+
+			// Pincer a must hold X but not Y; its other value is Z...
+
+			av := pair_values[a]
+			z := -1
+			if av[0] == px && av[1] != py {
+				z = av[1]
+			} else if av[1] == px && av[0] != py {
+				z = av[0]
+			}
+			if z == -1 {
+				continue
+			}
+
+			for _, b := range pairs {
+
+				bv := pair_values[b]
+				if b == a || sees(pivot, b) == false || !((bv[0] == py && bv[1] == z) || (bv[1] == py && bv[0] == z)) {
+					continue
+				}
+
+				for x := 0; x < 9; x++ {
+					for y := 0; y < 9; y++ {
+						point := Point{x, y}
+						if point == pivot || marks[x][y][z] == false || self.Count(x, y) == 1 {
+							continue
+						}
+						if sees(point, a) && sees(point, b) {
+							step := Step{"xy-wing", x, y, index_to_digit(z), true}
+							if eliminated[step] == false {
+								eliminated[step] = true
+								ret = append(ret, step)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) find_coloring() []Step {
+
+	// Simple coloring. For each value, units where it has exactly two possible places give conjugate pairs:
+	// one of the pair must be the value. Chains of such pairs are colored alternately, so that one color is
+	// entirely true and the other entirely false. Then...
+	//
+	//		- If two cells of the same color see each other, that color is false (color wrap).
+	//		- Any other cell which sees both colors can't hold the value (color trap).
+
+	var ret []Step
+	marks := self.marks()
+
+	for val := 0; val < 9; val++ {
+
+		links := make(map[Point][]Point)
+
+		for _, unit := range all_units {
+			var places []Point
+			for _, point := range unit {
+				if marks[point.X][point.Y][val] {
+					places = append(places, point)
+				}
+			}
+			if len(places) == 2 && self.Count(places[0].X, places[0].Y) > 1 && self.Count(places[1].X, places[1].Y) > 1 {
+				links[places[0]] = append(links[places[0]], places[1])
+				links[places[1]] = append(links[places[1]], places[0])
+			}
+		}
+
+		colors := make(map[Point]int)					// Each chain gets colors 2*c and 2*c+1
+		var chains [][2][]Point
+
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+
+				start := Point{x, y}
+				if _, done := colors[start]; done || len(links[start]) == 0 {
+					continue
+				}
+
+				base := len(chains) * 2
+				var chain [2][]Point
+
+				colors[start] = base
+				queue := []Point{start}
+
+				for len(queue) > 0 {
+					point := queue[0]
+					queue = queue[1:]
+					chain[colors[point] - base] = append(chain[colors[point] - base], point)
+					for _, other := range links[point] {
+						if _, done := colors[other]; !done {
+							colors[other] = base + 1 - (colors[point] - base)
+							queue = append(queue, other)
+						}
+					}
+				}
+
+				chains = append(chains, chain)
+			}
+		}
+
+		eliminated := make(map[Point]bool)				// Don't report the same elimination twice
+
+		eliminate := func(point Point) {
+			if eliminated[point] == false {
+				eliminated[point] = true
+				ret = append(ret, Step{"coloring", point.X, point.Y, index_to_digit(val), true})
+			}
+		}
+
+		for _, chain := range chains {
+
+			wrapped := false
+
+			for c := 0; c < 2 && !wrapped; c++ {
+				for i, a := range chain[c] {
+					for _, b := range chain[c][i + 1:] {
+						if sees(a, b) {
+							wrapped = true
+						}
+					}
+				}
+				if wrapped {
+					for _, point := range chain[c] {
+						eliminate(point)
+					}
+				}
+			}
+
+			if wrapped {
+				continue
+			}
+
+			for x := 0; x < 9; x++ {
+				for y := 0; y < 9; y++ {
+					point := Point{x, y}
+					if marks[x][y][val] == false || self.Count(x, y) == 1 {
+						continue
+					}
+					if _, colored := colors[point]; colored && colors[point] / 2 == colors[chain[0][0]] / 2 {
+						continue
+					}
+					sees_color := [2]bool{}
+					for c := 0; c < 2; c++ {
+						for _, other := range chain[c] {
+							if sees(point, other) {
+								sees_color[c] = true
+								break
+							}
+						}
+					}
+					if sees_color[0] && sees_color[1] {
+						eliminate(point)
+					}
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) AvailableDeductions() []Step {
+
+	// Every step any strategy could make from the current position, easiest techniques first, without
+	// applying them. A deduction found by several techniques is only listed under the easiest. Note that
+	// grids set up with Set() or SetFromString() have already had their singles applied by propagation.
+
+	var ret []Step
+	seen := make(map[Step]bool)
+
+	for _, strat := range human_strategies {
+		for _, step := range strat.find(self) {
+			key := step
+			key.Technique = ""
+			if seen[key] == false {
+				seen[key] = true
+				ret = append(ret, step)
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) SolveHuman() (*Grid, []Step, error) {
+
+	// Solve from the givens by logic alone, always taking a step from the easiest strategy available.
+	// Returns the solution and the steps taken. If the strategies run dry, returns ErrRequiresGuessing
+	// along with the steps made so far.
+
+	grid := self.pencil_grid()
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if grid.Count(x, y) != 1 {
+				continue
+			}
+			for _, peer := range lookup_peers[x][y] {
+				if grid.Count(peer.X, peer.Y) == 1 && grid.Value(peer.X, peer.Y) == grid.Value(x, y) {
+					return nil, nil, ErrContradictoryGivens
+				}
+			}
+		}
+	}
+
+	var steps []Step
+
+	for {
+		marks := grid.marks()
+		solved := true
+
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				if grid.Count(x, y) > 1 {
+					solved = false
+					if marks[x][y] == [9]bool{} {
+						return nil, steps, ErrNoSolution
+					}
+				}
+			}
+		}
+
+		if solved {
+			return grid, steps, nil
+		}
+
+		progress := false
+
+		for _, strat := range human_strategies {
+			found := strat.find(grid)
+			if len(found) > 0 {
+				grid.apply_step(found[0])
+				steps = append(steps, found[0])
+				progress = true
+				break
+			}
+		}
+
+		if !progress {
+			return nil, steps, ErrRequiresGuessing
+		}
+	}
+}
+
+type Session struct {									// A complete logical solve, for saving and replaying
+	Givens		[]Clue
+	Steps		[]Step
+	Solution	*Grid
+}
+
+func (self *Grid) SolveSession() (*Session, error) {	// Errors as per SolveHuman(), i.e. if guessing is required
+	solution, steps, err := self.SolveHuman()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{self.Givens(), steps, solution}, nil
+}
+
+func (self *Session) MarshalJSON() ([]byte, error) {	// The solution is written as an 81-char string
+	var solution string
+	if self.Solution != nil {
+		rows := self.Solution.Rows()
+		solution = strings.Join(rows[:], "")
+	}
+	return json.Marshal(struct {
+		Givens		[]Clue	`json:"givens"`
+		Steps		[]Step	`json:"steps"`
+		Solution	string	`json:"solution"`
+	}{self.Givens, self.Steps, solution})
+}
+
+func (self *Grid) RequiresGuessing() bool {				// Whether SolveHuman() gets stuck, i.e. the strategies aren't enough
+	_, _, err := self.SolveHuman()
+	return errors.Is(err, ErrRequiresGuessing)
+}
+
+func (self *Grid) SolvingPathLength() (int, error) {	// The number of logical steps SolveHuman() needs. Errors if guessing is required.
+	_, steps, err := self.SolveHuman()
+	if err != nil {
+		return 0, err
+	}
+	return len(steps), nil
+}
+
+func (self *Grid) StrategyReach(strategies StrategySet) int {
+
+	// Starting from the givens alone, apply only the chosen strategies until they run dry, and return how
+	// many cells they solved (not counting the givens). Useful for comparing what each technique can do.
+
+	grid := self.pencil_grid()
+	start := count_clues(grid.Values())
+
+	for {
+		var steps []Step
+		for i, strat := range human_strategies {
+			if strategies & (1 << uint(i)) != 0 {
+				steps = strat.find(grid)
+				if len(steps) > 0 {
+					break
+				}
+			}
+		}
+		if len(steps) == 0 {
+			break
+		}
+		grid.apply_step(steps[0])
+	}
+
+	return count_clues(grid.Values()) - start
+}
+
+func (self *Grid) Coach() (string, []Point, error) {
+
+	// A beginner-friendly description of the easiest next move, plus the cells worth highlighting. Like
+	// AvailableDeductions(), this looks at the grid as it stands. Returns ErrNoSolution if some cell has no
+	// candidates left, or ErrRequiresGuessing if no strategy can make progress.
+
+	if _, _, legal := self.branch_point(); !legal {
+		return "", nil, ErrNoSolution
+	}
+
+	deductions := self.AvailableDeductions()
+
+	if len(deductions) == 0 {
+		if self.PercentComplete() == 1 {
+			return "The puzzle is solved!", nil, nil
+		}
+		return "", nil, ErrRequiresGuessing
+	}
+
+	step := deductions[0]
+	target := Point{step.X, step.Y}
+	name := PointToName(target)
+	marks := self.marks()
+	n := digit_to_index(step.Digit)
+
+	// For the unit-based techniques, find the unit the deduction comes from. Boxes are tried first,
+	// since they're usually what a learner is scanning.
+
+	units := lookup_units[step.X][step.Y]
+	var unit []Point
+
+	for i := len(units) - 1; i >= 0 && unit == nil; i-- {
+		empty, places := 0, 0
+		for _, point := range units[i] {
+			if self.Count(point.X, point.Y) > 1 {
+				empty++
+			}
+			if marks[point.X][point.Y][n] {
+				places++
+			}
+		}
+		if (step.Technique == "full house" && empty == 1) || (step.Technique == "hidden single" && places == 1) {
+			unit = units[i]
+		}
+	}
+
+	digit := self.symbol(step.Digit)
+	a := "a"
+	if digit == "8" {
+		a = "an"
+	}
+
+	var msg string
+
+	switch {
+	case step.Technique == "full house" && unit != nil:
+		msg = fmt.Sprintf("Look at %s: only one cell is still empty, so it must be the missing %s.", unit_name(unit), digit)
+	case step.Technique == "naked single":
+		msg = fmt.Sprintf("Look at %s: every digit except %s is already used in its row, column or box.", name, digit)
+	case step.Technique == "hidden single" && unit != nil:
+		msg = fmt.Sprintf("Look at %s: only one cell can be %s %s \u2014 the highlighted one.", unit_name(unit), a, digit)
+	case step.Eliminated:
+		msg = fmt.Sprintf("Using %s, you can show that %s can't be %s %s.", step.Technique, name, a, digit)
+	default:
+		msg = fmt.Sprintf("Using %s, you can show that %s must be %s %s.", step.Technique, name, a, digit)
+	}
+
+	return msg, []Point{target}, nil
+}
+
+func (self *Grid) SolvePartial(maxCells int) *Grid {
+
+	// Reveal up to maxCells more cells by applying the easiest available deductions one at a time, much as
+	// SolveHuman() does. Unlike Solve(), the result is not propagated any further, so at most maxCells cells
+	// are solved in it that weren't solved in the receiver. Returns nil if the grid is illegal.
+
+	if _, _, legal := self.branch_point(); !legal {
+		return nil
+	}
+
+	solved := func(g *Grid) int {
+		marks := g.marks()
+		ret := 0
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				count := 0
+				for n := 0; n < 9; n++ {
+					if marks[x][y][n] {
+						count++
+					}
+				}
+				if count == 1 {
+					ret++
+				}
+			}
+		}
+		return ret
+	}
+
+	limit := solved(self) + maxCells
+	grid := self.Copy()
+
+	for {
+		deductions := grid.AvailableDeductions()
+		if len(deductions) == 0 {
+			break
+		}
+		before := grid.cells
+		grid.apply_step(deductions[0])
+		if solved(grid) > limit {
+			grid.set_cells(before)
+			break
+		}
+	}
+
+	grid.set_cells(grid.marks())				// So the result needs no propagation to be safe to use
+	return grid
+}
+
+func (self *Grid) propagated() *Grid {					// A normal grid (i.e. safe to search) with the same candidates as this pencil grid
+	marks := self.marks()
+	ret := NewGrid()
+	ret.givens = self.givens
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			for n := 0; n < 9; n++ {
+				if marks[x][y][n] == false {
+					ret.Eliminate(x, y, n)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func VerifySteps(start *Grid, steps []Step) error {
+
+	// Replay the steps from the start grid's givens, checking each deduction by search: a placed digit must
+	// be the only one that leads to a solution, and an eliminated digit must lead to none.
+
+	grid := start.pencil_grid()
+
+	for i, step := range steps {
+
+		if step.X < 0 || step.X > 8 || step.Y < 0 || step.Y > 8 || step.Digit < 1 || step.Digit > 9 {
+			return fmt.Errorf("step %d (%s): bad coordinates or digit", i, step.Technique)
+		}
+
+		n := digit_to_index(step.Digit)
+		state := grid.propagated()
+
+		if step.Eliminated {
+			if state.cells[step.X][step.Y][n] {
+				foo := state.Copy()
+				foo.Set(step.X, step.Y, n)
+				if foo.EnumerateSolutions(1, nil) > 0 {
+					return fmt.Errorf("step %d (%s): %d at %d,%d is still possible", i, step.Technique, step.Digit, step.X, step.Y)
+				}
+			}
+		} else {
+			if state.cells[step.X][step.Y][n] == false {
+				return fmt.Errorf("step %d (%s): %d at %d,%d is not a candidate", i, step.Technique, step.Digit, step.X, step.Y)
+			}
+			foo := state.Copy()
+			foo.Eliminate(step.X, step.Y, n)
+			if foo.EnumerateSolutions(1, nil) > 0 {
+				return fmt.Errorf("step %d (%s): %d at %d,%d is not forced", i, step.Technique, step.Digit, step.X, step.Y)
+			}
+		}
+
+		grid.apply_step(step)
+	}
+
+	return nil
+}
+
+// ------------------------------------------------------------------------------------------------
+// Grid - extra strategies beyond Norvig's two. These apply the eliminations from a detector via Eliminate(),
+// so any consequences propagate as usual. Each returns true if anything was eliminated.
+
+func (self *Grid) apply_eliminations(steps []Step) bool {
+	ret := false
+	for _, step := range steps {
+		n := digit_to_index(step.Digit)
+		if step.Eliminated && self.cells[step.X][step.Y][n] {
+			self.Eliminate(step.X, step.Y, n)
+			ret = true
+		}
+	}
+	return ret
+}
+
+func (self *Grid) ApplyLockedCandidates() int {	// Unlike the others, returns how many eliminations were made directly
+	count := 0
+	for _, step := range self.find_locked_candidates() {
+		n := digit_to_index(step.Digit)
+		if self.cells[step.X][step.Y][n] {
+			self.Eliminate(step.X, step.Y, n)
+			count++
+		}
+	}
+	return count
+}
+
+func (self *Grid) PropagationStable() bool {
+
+	// A check on the strategies themselves: on a copy, apply the extra strategies until none reports any
+	// change, then confirm that one more round really does nothing, and that Norvig's two rules have nothing
+	// left to do either. False means some strategy (or the propagation) is misreporting its changes.
+
+	foo := self.Copy()
+	for foo.ApplyLockedCandidates() > 0 || foo.EliminateXYWing() || foo.EliminateColoring() {}
+
+	before := foo.cells
+
+	if foo.ApplyLockedCandidates() > 0 || foo.EliminateXYWing() || foo.EliminateColoring() || foo.cells != before {
+		return false
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if foo.Count(x, y) != 1 {
+				continue
+			}
+			for _, peer := range lookup_peers[x][y] {
+				if foo.cells[peer.X][peer.Y][foo.Value(x, y)] {
+					return false					// Rule 1 wasn't applied
+				}
+			}
+		}
+	}
+
+	for _, unit := range all_units {
+		for n := 0; n < 9; n++ {
+			places := 0
+			var place Point
+			for _, point := range unit {
+				if foo.cells[point.X][point.Y][n] {
+					places++
+					place = point
+				}
+			}
+			if places == 1 && foo.Count(place.X, place.Y) > 1 {
+				return false						// Rule 2 wasn't applied
+			}
+		}
+	}
+
+	return true
+}
+
+func (self *Grid) EliminateXYWing() bool {
+	return self.apply_eliminations(self.find_xy_wing())
+}
+
+func (self *Grid) EliminatePairs() bool {			// Naked and hidden pairs, repeated until neither finds anything. True if anything changed.
+	ret := false
+	for self.apply_eliminations(self.find_naked_pairs()) || self.apply_eliminations(self.find_hidden_pairs()) {
+		ret = true
+	}
+	return ret
+}
+
+func (self *Grid) EliminateColoring() bool {
+	return self.apply_eliminations(self.find_coloring())
+}
+
+// ------------------------------------------------------------------------------------------------
+// Grid - rating and puzzle creation...
+
+var Difficulties = []string{"easy", "medium", "hard", "fiendish"}		// In increasing order of difficulty
+
+func difficulty_rank(difficulty string) int {		// Index into Difficulties, or -1 if unknown
+	for i, d := range Difficulties {
+		if d == difficulty {
+			return i
+		}
+	}
+	return -1
+}
+
+func (self *Grid) Difficulty() string {				// Rating based on the size of the search tree. Returns "" if there's no solution.
+
+	foo := self.Copy()
+	foo.ResetSteps()								// Don't pollute the original's count
+
+	if foo.solve() == nil {
+		return ""
+	}
+
+	return difficulty_for_steps(*foo.steps)
+}
+
+func difficulty_for_steps(steps int) string {		// The Difficulty() rating for a search tree of this size
+	if steps == 1 {									// Solved by propagation alone, no guessing
+		return "easy"
+	} else if steps <= 10 {
+		return "medium"
+	} else if steps <= 100 {
+		return "hard"
+	}
+	return "fiendish"
+}
+
+func (self *Grid) EstimateDifficultyFast() int {
+
+	// A cheap, rough guide to the cost of solving, for use before committing to Solve(): 0 means solved
+	// already, and bigger means slower. It's the number of surplus candidates in the grid, plus the same
+	// for each branch which survives one level of search at the cell Solve() would branch on. Not
+	// comparable with Difficulty(). Returns -1 if the grid is illegal.
+
+	surplus := func(g *Grid) int {
+		ret := 0
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				ret += g.Count(x, y) - 1
+			}
+		}
+		return ret
+	}
+
+	x, y, legal := self.branch_point()
+
+	if !legal {
+		return -1
+	} else if x == -1 {
+		return 0
+	}
+
+	ret := surplus(self)
+
+	for _, n := range self.Possibles(x, y) {
+		foo := self.Copy()
+		foo.Set(x, y, n)
+		if _, _, legal := foo.branch_point(); legal {
+			ret += surplus(foo)
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) HasDeadlyPattern() bool {
+
+	// Whether the solution contains an unavoidable rectangle: 4 non-given cells on 2 rows and 2 columns, lying
+	// in exactly 2 boxes, holding a b / b a. Swapping the a's and b's gives a second solution, so a puzzle with
+	// one is never unique. False if there's no solution.
+
+	solution := self.Copy()
+	solution.ResetSteps()
+	solution = solution.solve()
+
+	if solution == nil {
+		return false
+	}
+
+	values := solution.Values()
+	givens := self.puzzle_values()
+
+	for x1 := 0; x1 < 9; x1++ {
+		for x2 := x1 + 1; x2 < 9; x2++ {
+			for y1 := 0; y1 < 9; y1++ {
+				for y2 := y1 + 1; y2 < 9; y2++ {
+					if BoxIndex(x1, y1) != BoxIndex(x2, y1) && BoxIndex(x1, y1) != BoxIndex(x1, y2) {
+						continue						// 4 boxes, so the swap would break them
+					}
+					if givens[x1][y1] != 0 || givens[x1][y2] != 0 || givens[x2][y1] != 0 || givens[x2][y2] != 0 {
+						continue
+					}
+					if values[x1][y1] == values[x2][y2] && values[x1][y2] == values[x2][y1] {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+type DifficultyFingerprint struct {
+	Rating		string							// As per Difficulty()
+	Hardest		string							// The hardest technique SolveHuman() used, or "guessing" if logic wasn't enough
+	Techniques	map[string]int					// How many steps SolveHuman() took with each technique
+	Steps		int								// Total logical steps taken by SolveHuman(), before it finished or got stuck
+	Guesses		int								// As per GuessCount(), or 0 if there's no solution
+}
+
+func (self *Grid) Fingerprint() DifficultyFingerprint {
+
+	var ret DifficultyFingerprint
+
+	ret.Rating = self.Difficulty()
+	ret.Techniques = make(map[string]int)
+
+	_, steps, err := self.SolveHuman()
+
+	hardest := -1
+	for _, step := range steps {
+		ret.Techniques[step.Technique]++
+		for i, strat := range human_strategies {
+			if strat.name == step.Technique && i > hardest {
+				hardest = i
+			}
+		}
+	}
+
+	if errors.Is(err, ErrRequiresGuessing) {
+		ret.Hardest = "guessing"
+	} else if hardest != -1 {
+		ret.Hardest = human_strategies[hardest].name
+	}
+
+	ret.Steps = len(steps)
+	ret.Guesses, _ = self.GuessCount()
+
+	return ret
+}
+
+// Scoring weights for Score(), exported so apps can tune them.
+
+var (
+	ScoreDifficultyPoints	= []int{100, 200, 400, 800}		// Base points for each entry of Difficulties
+	ScoreParTime			= 10 * time.Minute				// Solving faster than this earns a bonus
+	ScoreTimeBonus			= 100							// The bonus for an instant solve, falling linearly to 0 at ScoreParTime
+	ScoreHintPenalty		= 50							// Deducted per hint used
+	ScoreMistakePenalty		= 25							// Deducted per mistake
+)
+
+func (self *Grid) Score(hintsUsed, mistakes int, elapsed time.Duration) int {
+
+	// Points for a completed solve of this puzzle:
+	//
+	//		ScoreDifficultyPoints[rank of Difficulty()]
+	//		+ ScoreTimeBonus * (ScoreParTime - elapsed) / ScoreParTime		(only if elapsed < ScoreParTime)
+	//		- ScoreHintPenalty * hintsUsed
+	//		- ScoreMistakePenalty * mistakes
+	//
+	// never going below 0. An unsolvable puzzle scores 0.
+
+	rank := difficulty_rank(self.Difficulty())
+
+	if rank == -1 || rank >= len(ScoreDifficultyPoints) {
+		return 0
+	}
+
+	score := ScoreDifficultyPoints[rank]
+
+	if elapsed < ScoreParTime && ScoreParTime > 0 {
+		score += int(int64(ScoreTimeBonus) * int64(ScoreParTime - elapsed) / int64(ScoreParTime))
+	}
+
+	score -= ScoreHintPenalty * hintsUsed + ScoreMistakePenalty * mistakes
+
+	if score < 0 {
+		return 0
+	}
+
+	return score
+}
+
+func (self *Grid) RedundantClues() []Point {
+
+	// The givens, in reading order, any one of which could be removed with the puzzle still having a unique
+	// solution. (Removing several together may not work.) A minimal puzzle has none. Returns nil if the
+	// puzzle isn't unique to begin with.
+
+	redundant, _ := self.classify_clues()
+	return redundant
+}
+
+func (self *Grid) CriticalClues() []Point {
+
+	// The opposite of RedundantClues(): the givens whose removal would let in more solutions. In a minimal
+	// puzzle, this is all of them. Returns nil if the puzzle isn't unique to begin with.
+
+	_, critical := self.classify_clues()
+	return critical
+}
+
+func (self *Grid) classify_clues() (redundant, critical []Point) {	// Try removing each given alone, in reading order
+
+	values := self.puzzle_values()
+
+	if grid, err := NewGridFromInts(values); err != nil || grid.EnumerateSolutions(2, nil) != 1 {
+		return nil, nil
+	}
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if values[x][y] == 0 {
+				continue
+			}
+			removed := values[x][y]
+			values[x][y] = 0
+			if grid_from_values(values).EnumerateSolutions(2, nil) == 1 {
+				redundant = append(redundant, Point{x, y})
+			} else {
+				critical = append(critical, Point{x, y})
+			}
+			values[x][y] = removed
+		}
+	}
+
+	return redundant, critical
+}
+
+func (self *Grid) Carve(target string, r *rand.Rand) (*Grid, error) {
+
+	// Starting from a complete grid, remove clues while the puzzle is no harder than the target.
+	// Errors if the target can't be reached.
+
+	target_rank := difficulty_rank(target)
+
+	if target_rank == -1 {
+		return nil, fmt.Errorf("Carve(): unknown difficulty %q", target)
+	}
+
+	if self.Validate() == false {
+		return nil, errors.New("Carve(): grid is not a valid complete solution")
+	}
+
+	puzzle := remove_clues(self.Values(), r, func(values [9][9]int) bool {
+		return difficulty_rank(grid_from_values(values).Difficulty()) <= target_rank
+	})
+
+	if difficulty_rank(puzzle.Difficulty()) < target_rank {
+		return nil, fmt.Errorf("Carve(): could not reach difficulty %q", target)
+	}
+
+	return puzzle, nil
+}
+
+func (self *Grid) GenerateTwin(r *rand.Rand) (*Grid, error) {
+
+	// A different puzzle with the same solution and the same Difficulty(), made by carving the solution
+	// afresh. Errors if the puzzle isn't unique, or no twin turns up within generate_attempts carvings.
+
+	solution, err := self.SolveUnique()
+
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty := self.Difficulty()
+	original := self.puzzle_values()
+
+	for attempt := 0; attempt < generate_attempts; attempt++ {
+		twin, err := solution.Carve(difficulty, r)
+		if err == nil && twin.Difficulty() == difficulty && twin.puzzle_values() != original {
+			return twin, nil
+		}
+	}
+
+	return nil, fmt.Errorf("GenerateTwin(): no %s twin found in %d attempts", difficulty, generate_attempts)
+}
+
+const generate_attempts = 20							// How many fresh solution grids a generator may try
+
+func GeneratePuzzle(r *rand.Rand, minClues int) (puzzle, solution *Grid, err error) {
+
+	// Generate a unique puzzle from a fresh random solution, removing clues in random order for as long as
+	// uniqueness allows, but never going below minClues. The result may well have more clues than that.
+	// The solution is returned too, so callers needn't solve the puzzle again.
+
+	if minClues < 0 || minClues > 81 {
+		return nil, nil, fmt.Errorf("GeneratePuzzle(): bad clue count %d", minClues)
+	}
+
+	solution = NewGrid().SolveRandom(r)
+
+	puzzle = remove_clues(solution.Values(), r, func(values [9][9]int) bool {
+		return count_clues(values) >= minClues
+	})
+
+	return puzzle, solution, nil
+}
+
+func GeneratePuzzleExact(r *rand.Rand, clues int) (puzzle, solution *Grid, err error) {
+
+	// As GeneratePuzzle(), but the puzzle has exactly the requested number of clues. Removal can get stuck
+	// above the target (no clue can go without breaking uniqueness), in which case we start again from a
+	// fresh random solution, up to generate_attempts times. Low targets (below about 22) rarely succeed.
+
+	if clues < 0 || clues > 81 {
+		return nil, nil, fmt.Errorf("GeneratePuzzleExact(): bad clue count %d", clues)
+	}
+
+	for attempt := 0; attempt < generate_attempts; attempt++ {
+
+		puzzle, solution, _ = GeneratePuzzle(r, clues)
+
+		if len(puzzle.Givens()) == clues {
+			return puzzle, solution, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("GeneratePuzzleExact(): couldn't reach %d clues in %d attempts", clues, generate_attempts)
+}
+
+func GenerateWithSolutionCount(target int, r *rand.Rand) (*Grid, error) {
+
+	// Generate a deliberately non-unique puzzle with exactly target solutions (target 1 gives an ordinary
+	// puzzle). Clues are removed in random order, each removal standing only if the count stays within the
+	// target. If the count doesn't end up exactly on target, we start again, up to generate_attempts times.
+
+	if target < 1 {
+		return nil, fmt.Errorf("GenerateWithSolutionCount(): bad target %d", target)
+	}
+
+	for attempt := 0; attempt < generate_attempts; attempt++ {
+
+		values := NewGrid().SolveRandom(r).Values()
+		solutions := 1
+
+		for _, i := range r.Perm(81) {
+
+			x := i % 9
+			y := i / 9
+
+			removed := values[x][y]
+			values[x][y] = 0
+
+			count := grid_from_values(values).EnumerateSolutions(target + 1, nil)
+
+			if count > target {
+				values[x][y] = removed
+			} else {
+				solutions = count
+			}
+		}
+
+		if solutions == target {
+			return grid_from_values(values), nil
+		}
+	}
+
+	return nil, fmt.Errorf("GenerateWithSolutionCount(): couldn't reach %d solutions in %d attempts", target, generate_attempts)
+}
+
+func GenerateLogicOnly(difficulty string, r *rand.Rand) (*Grid, error) {
+
+	// Generate a puzzle of the given difficulty which SolveHuman() can finish without guessing. Clues
+	// are removed while both hold, and we start again if the result ends up too easy.
+
+	rank := difficulty_rank(difficulty)
+
+	if rank == -1 {
+		return nil, fmt.Errorf("GenerateLogicOnly(): unknown difficulty %q", difficulty)
+	}
+
+	for attempt := 0; attempt < generate_attempts; attempt++ {
+
+		solution := NewGrid().SolveRandom(r)
+
+		puzzle := remove_clues(solution.Values(), r, func(values [9][9]int) bool {
+			foo := grid_from_values(values)
+			return difficulty_rank(foo.Difficulty()) <= rank && foo.RequiresGuessing() == false
+		})
+
+		if puzzle.Difficulty() == difficulty {
+			return puzzle, nil
+		}
+	}
+
+	return nil, fmt.Errorf("GenerateLogicOnly(): no %q puzzle found in %d attempts", difficulty, generate_attempts)
+}
+
+func GenerateWithFixedGivens(fixed []Clue, r *rand.Rand) (*Grid, error) {
+
+	// Generate a puzzle which keeps the given clues. The solution is a random completion of them,
+	// and other clues are then removed while keeping the solution unique.
+
+	var values [9][9]int
+
+	for _, clue := range fixed {
+		if clue.X < 0 || clue.X > 8 || clue.Y < 0 || clue.Y > 8 || clue.Digit < 1 || clue.Digit > 9 {
+			return nil, fmt.Errorf("GenerateWithFixedGivens(): bad clue %v", clue)
+		}
+		if values[clue.X][clue.Y] != 0 && values[clue.X][clue.Y] != clue.Digit {
+			return nil, ErrContradictoryGivens
+		}
+		values[clue.X][clue.Y] = clue.Digit
+	}
+
+	grid := NewGrid()
+
+	if grid.set_values(values) != nil {
+		return nil, ErrContradictoryGivens
+	}
+
+	solution := grid.SolveRandom(r)
+
+	if solution == nil {
+		return nil, ErrNoSolution
+	}
+
+	return remove_clues(solution.Values(), r, func(values [9][9]int) bool {
+		for _, clue := range fixed {
+			if values[clue.X][clue.Y] == 0 {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+func count_clues(values [9][9]int) int {
+	ret := 0
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if values[x][y] != 0 {
+				ret++
+			}
+		}
+	}
+	return ret
+}
+
+func GenerateBalanced(r *rand.Rand, minPerBox int) (*Grid, error) {	// Generate a puzzle with at least minPerBox clues in each 3x3 box
+
+	if minPerBox < 0 || minPerBox > 9 {
+		return nil, fmt.Errorf("GenerateBalanced(): bad minPerBox %d", minPerBox)
+	}
+
+	solution := NewGrid().SolveRandom(r)
+
+	return remove_clues(solution.Values(), r, func(values [9][9]int) bool {
+		var clues [9]int
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				if values[x][y] != 0 {
+					clues[BoxIndex(x, y)]++
+				}
+			}
+		}
+		for _, n := range clues {
+			if n < minPerBox {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+func remove_clues(values [9][9]int, r *rand.Rand, keep func([9][9]int) bool) *Grid {
+
+	// Remove clues in random order. Each removal stands only if keep() (if not nil) approves the new
+	// values and the puzzle still has a unique solution. Returns the final puzzle.
+
+	for _, i := range r.Perm(81) {
+
+		x := i % 9
+		y := i / 9
+
+		if values[x][y] == 0 {
+			continue
+		}
+
+		removed := values[x][y]
+		values[x][y] = 0
+
+		if (keep != nil && keep(values) == false) || grid_from_values(values).CountSolutions(2) != 1 {
+			values[x][y] = removed
+		}
+	}
+
+	return grid_from_values(values)
+}
+
+func (self *Grid) RepairGivens(maxChanges int) ([]Clue, error) {
+
+	// Find the smallest set of givens (up to maxChanges of them) which, when altered, leaves a uniquely solvable
+	// puzzle. For each candidate set of suspect givens, we first check that the other givens have a solution at
+	// all, then try every alternative for each suspect: a different digit, or removing it altogether. Between
+	// repairs with the same number of changes, those removing more givens are preferred, since a misread digit
+	// is more often a smudge than a real clue. Returns the corrected clues, without any that were removed.
+
+	clues := self.Givens()
+
+	for k := 0; k <= maxChanges && k <= len(clues); k++ {
+		for removals := k; removals >= 0; removals-- {
+			if result := repair_givens(clues, k, removals); result != nil {
+				return result, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("RepairGivens(): no repair found within %d changes", maxChanges)
+}
+
+func repair_givens(clues []Clue, k, removals int) []Clue {
+
+	// Try every way of altering k of the clues, exactly removals of which are removed, returning the first
+	// set of corrected clues with a unique solution, or nil.
+
+	var result []Clue
+
+	combinations(len(clues), k, func(suspects []int) bool {
+
+		var values [9][9]int
+		for _, clue := range clues {
+			values[clue.X][clue.Y] = clue.Digit
+		}
+		for _, i := range suspects {
+			values[clues[i].X][clues[i].Y] = 0
+		}
+
+		grid := NewGrid()
+		if grid.set_values(values) != nil || grid.EnumerateSolutions(1, nil) == 0 {
+			return true									// The rest of the givens are bad, so altering these won't help
+		}
+
+		// Try every assignment of new values to the suspects, odometer style, where 0 means removal...
+
+		digits := make([]int, k)
+
+		for {
+			zeros := 0
+			altered := true
+			for j, i := range suspects {
+				values[clues[i].X][clues[i].Y] = digits[j]
+				if digits[j] == 0 {
+					zeros++
+				}
+				if digits[j] == clues[i].Digit {
+					altered = false						// Not a change at all - covered by a smaller k
+				}
+			}
+
+			if altered && zeros == removals {
+				foo := NewGrid()
+				if foo.set_values(values) == nil && foo.EnumerateSolutions(2, nil) == 1 {
+					for _, clue := range clues {
+						clue.Digit = values[clue.X][clue.Y]
+						if clue.Digit != 0 {
+							result = append(result, clue)
+						}
+					}
+					return false
+				}
+			}
+
+			j := 0
+			for j < k {
+				digits[j]++
+				if digits[j] <= 9 {
+					break
+				}
+				digits[j] = 0
+				j++
+			}
+			if j == k {
+				return true
+			}
+		}
+	})
+
+	return result
+}
+
+func combinations(n, k int, f func([]int) bool) bool {	// Call f with each k-sized subset of 0..n-1 until it returns false
+
+	indices := make([]int, k)
+
+	var recurse func(start, depth int) bool
+
+	recurse = func(start, depth int) bool {
+		if depth == k {
+			return f(indices)
+		}
+		for i := start; i < n; i++ {
+			indices[depth] = i
+			if recurse(i + 1, depth + 1) == false {
+				return false
+			}
+		}
+		return true
+	}
+
+	return recurse(0, 0)
+}
+
+func grid_from_values(values [9][9]int) *Grid {		// Values are 1-9, with 0 for an empty cell. Panics if the values are contradictory.
+	ret := NewGrid()
+	err := ret.set_values(values)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// ------------------------------------------------------------------------------------------------
+// Grid - utility methods...
+
+var default_alphabet = []rune("123456789")
+
+func (self *Grid) SetAlphabet(alphabet string) error {	// Set the 9 symbols used for 1-9 by every display method, and by SetFromString()
+
+	symbols := []rune(alphabet)
+
+	if len(symbols) != 9 {
+		return fmt.Errorf("SetAlphabet(): need 9 symbols, got %d", len(symbols))
+	}
+
+	for i, c := range symbols {
+		if c == '.' || c == '0' || c == '?' || c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			return fmt.Errorf("SetAlphabet(): symbol %q is reserved", c)
+		}
+		for _, c2 := range symbols[:i] {
+			if c == c2 {
+				return fmt.Errorf("SetAlphabet(): symbol %q appears twice", c)
+			}
+		}
+	}
+
+	self.alphabet = symbols
+	return nil
+}
+
+func (self *Grid) symbols() []rune {
+	if self.alphabet == nil {
+		return default_alphabet
+	}
+	return self.alphabet
+}
+
+func (self *Grid) symbol(d int) string {			// How the digit d (1-9) is shown. Every display path should use this or symbols().
+	return string(self.symbols()[d - 1])
+}
+
+func (self *Grid) Print() {
+	self.Fprint(os.Stdout)
+}
+
+func (self *Grid) Fprint(w io.Writer) error {		// As Print(), but to any writer
+	symbols := self.symbols()
+	return fprint_layout(w, func(x, y int) string {
+		s := "?"								// Used if no values found for the cell
+		for n := 0; n < 9; n++ {
+			if self.cells[x][y][n] {
+				if s == "?" {					// This is the first possible seen
+					s = string(symbols[index_to_digit(n) - 1])		// Internally we use 0 instead of 9
+				} else {						// We have seen 2 or more possibles, so we'll display "."
+					s = "."
+				}
+			}
+		}
+		return s
+	})
+}
+
+func fprint_layout(w io.Writer, cell func(x, y int) string) error {		// The bordered 9x9 layout used by Print()
+	for y := 0; y < 9; y++ {
+		if y == 3 || y == 6 {
+			if _, err := fmt.Fprintf(w, " ------+-------+------\n"); err != nil {
+				return err
+			}
+		}
+		line := ""
+		for x := 0; x < 9; x++ {
+			if x == 3 || x == 6 {
+				line += " |"
+			}
+			line += " " + cell(x, y)
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *Grid) PrintCandidates() {				// Like Print(), but showing every candidate, each cell as a 3x3 block
+	fprint_candidates(os.Stdout, self.marks(), [9][9][9]bool{}, self.symbols())
+}
+
+func fprint_candidates(w io.Writer, marks, removed [9][9][9]bool, symbols []rune) {	// Removed candidates (if any) are drawn as '*'
+
+	for y := 0; y < 9; y++ {
+		if y == 3 || y == 6 {
+			fmt.Fprintf(w, " ------------+-------------+------------\n")
+		}
+		for row := 0; row < 3; row++ {
+			line := ""
+			for x := 0; x < 9; x++ {
+				if x == 3 || x == 6 {
+					line += " |"
+				}
+				line += " "
+				for col := 0; col < 3; col++ {
+					d := row * 3 + col + 1
+					n := digit_to_index(d)
+					if marks[x][y][n] {
+						line += string(symbols[d - 1])
+					} else if removed[x][y][n] {
+						line += "*"
+					} else {
+						line += "."
+					}
+				}
+			}
+			fmt.Fprintf(w, "%s\n", line)
+		}
+		if y != 2 && y != 5 && y != 8 {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+}
+
+func (self *Grid) DemonstrateStrategy(strategies StrategySet, w io.Writer) {
+
+	// For documenting a technique: draw the candidates, run the easiest of the chosen strategies which finds
+	// anything, apply everything it found, and draw the candidates again with the removed ones shown as '*'.
+
+	before := self.marks()
+	foo := self.Copy()
+
+	var steps []Step
+	name := ""
+
+	for i, strat := range human_strategies {
+		if strategies & (1 << uint(i)) != 0 {
+			steps = strat.find(foo)
+			if len(steps) > 0 {
+				name = strat.name
+				break
+			}
+		}
+	}
+
+	if len(steps) == 0 {
+		fmt.Fprintf(w, "The chosen strategies find nothing here.\n")
+		return
+	}
+
+	for _, step := range steps {
+		foo.apply_step(step)
+	}
+
+	after := foo.marks()
+
+	var removed [9][9][9]bool
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			for n := 0; n < 9; n++ {
+				removed[x][y][n] = before[x][y][n] && !after[x][y][n]
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Before:\n\n")
+	fprint_candidates(w, before, [9][9][9]bool{}, self.symbols())
+	fmt.Fprintf(w, "\nAfter %s (%d deductions):\n\n", name, len(steps))
+	fprint_candidates(w, after, removed, self.symbols())
+}
+
+func (self *Grid) RenderPrintable(w io.Writer, solution *Grid) {
+
+	// Write an SVG page with the puzzle on the left and its solution on the right, headed with the difficulty.
+	// If solution is nil, the puzzle is solved here; if it has no solution the right-hand grid is left empty.
+
+	if solution == nil {
+		solution = self.Solve()
+	}
+
+	header := "Sudoku"
+	if difficulty := self.Difficulty(); difficulty != "" {
+		header = fmt.Sprintf("Sudoku (%s)", difficulty)
+	}
+
+	puzzle := self.puzzle_values()
+	var answer [9][9]int
+	if solution != nil {
+		answer = solution.Values()
+	}
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n", 860, 470)
+	fmt.Fprintf(w, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	fmt.Fprintf(w, "<text x=\"430\" y=\"40\" font-family=\"sans-serif\" font-size=\"24\" text-anchor=\"middle\">%s</text>\n", header)
+	write_svg_grid(w, 40, 70, puzzle, puzzle, self.symbols())
+	write_svg_grid(w, 460, 70, answer, puzzle, self.symbols())
+	fmt.Fprintf(w, "</svg>\n")
+}
+
+func write_svg_grid(w io.Writer, left, top int, values, givens [9][9]int, symbols []rune) {	// A 360px grid; givens in bold
+
+	for i := 0; i <= 9; i++ {
+		width := 1
+		if i % 3 == 0 {
+			width = 3
+		}
+		fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\" stroke-width=\"%d\"/>\n",
+			left + i * 40, top, left + i * 40, top + 360, width)
+		fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\" stroke-width=\"%d\"/>\n",
+			left, top + i * 40, left + 360, top + i * 40, width)
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if values[x][y] == 0 {
+				continue
+			}
+			weight := "normal"
+			if givens[x][y] != 0 {
+				weight = "bold"
+			}
+			fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" font-family=\"sans-serif\" font-size=\"24\" font-weight=\"%s\" text-anchor=\"middle\">%c</text>\n",
+				left + x * 40 + 20, top + y * 40 + 29, weight, symbols[values[x][y] - 1])
+		}
+	}
+}
+
+func (self *Grid) Values() [9][9]int {				// The solved digits 1-9, indexed [x][y], with 0 for unsolved cells
+	var ret [9][9]int
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.Count(x, y) == 1 {
+				ret[x][y] = index_to_digit(self.Value(x, y))
+			}
+		}
+	}
+	return ret
+}
+
+func parse_values(s string, symbols []rune) ([9][9]int, error) {	// Parse a puzzle string into digits 1-9 indexed [x][y], with 0 for empty cells
+
+	var ret [9][9]int
+	var numbers []int
+
+	for _, c := range s {
+		if c == '.' || c == '0' {
+			numbers = append(numbers, 0)
+			continue
+		}
+		for i, c2 := range symbols {
+			if c == c2 {
+				numbers = append(numbers, i + 1)
+				break
+			}
+		}
+	}
+
+	if len(numbers) != 81 {
+		return ret, fmt.Errorf("bad puzzle string: got %d cells, expected 81", len(numbers))
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			ret[x][y] = numbers[y * 9 + x]
+		}
+	}
+
+	return ret, nil
+}
+
+func NormalizeString(s string) (string, error) {
+
+	// Clean up a one-line puzzle string: digits 1-9 are kept, any recognised blank ('.', '0', '-', '_' or
+	// space) becomes '.', and everything else is dropped. Errors unless exactly 81 cells remain. Note this
+	// is stricter than SetFromString(), which must treat spaces and '-' as decoration so that it can read
+	// the grids drawn by Print().
+
+	var b strings.Builder
+	cells := 0
+
+	for _, c := range s {
+		if c >= '1' && c <= '9' {
+			b.WriteRune(c)
+		} else if c == '.' || c == '0' || c == '-' || c == '_' || c == ' ' {
+			b.WriteByte('.')
+		} else {
+			continue
+		}
+		cells++
+	}
+
+	if cells != 81 {
+		return "", fmt.Errorf("NormalizeString(): got %d cells, expected 81", cells)
+	}
+
+	return b.String(), nil
+}
+
+func (self *Grid) set_values(values [9][9]int) error {		// Set each non-zero digit as a given. Errors if one is already ruled out.
+
+	var err error
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if values[x][y] != 0 {
+				self.givens[x][y] = values[x][y]	// Record all givens first, even if some turn out to be contradictory
+			}
+		}
+	}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if values[x][y] == 0 {
+				continue
+			}
+			n := digit_to_index(values[x][y])
+			if self.cells[x][y][n] == false {		// Contradiction. Empty the cell so the grid shows it, and carry on.
+				err = ErrContradictoryGivens
+				for n2 := 0; n2 < 9; n2++ {
+					self.Eliminate(x, y, n2)
+				}
+				continue
+			}
+			self.Set(x, y, n)
+		}
+	}
+
+	return err
+}
+
+func (self *Grid) Rows() [9]string {				// Row y is Rows()[y], and its symbol x is the cell at x,y - the same orientation as Print()
+	var ret [9]string
+	symbols := self.symbols()
+	values := self.Values()
+	for y := 0; y < 9; y++ {
+		row := []rune(".........")
+		for x := 0; x < 9; x++ {
+			if values[x][y] != 0 {
+				row[x] = symbols[values[x][y] - 1]
+			}
+		}
+		ret[y] = string(row)
+	}
+	return ret
+}
+
+func (self *Grid) String() string {					// The 81-char line format read by SetFromString(), with '.' for unsolved cells
+	rows := self.Rows()
+	return strings.Join(rows[:], "")
+}
+
+func (self *Grid) IsGiven(x, y int) bool {
+	return self.givens[x][y] != 0
+}
+
+func (self *Grid) Givens() []Clue {
+	var ret []Clue
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if self.givens[x][y] != 0 {
+				ret = append(ret, Clue{x, y, self.givens[x][y]})
+			}
+		}
+	}
+	return ret
+}
+
+func (self *Grid) PackSolution() [41]byte {			// A solved grid's digits, 4 bits each in reading order, the first in the high nibble. Panics if unsolved.
+	var ret [41]byte
+	values := self.Values()
+	for i := 0; i < 81; i++ {
+		d := values[i % 9][i / 9]
+		if d == 0 {
+			panic("PackSolution() called on a grid that isn't fully solved")
+		}
+		if i % 2 == 0 {
+			ret[i / 2] |= byte(d) << 4
+		} else {
+			ret[i / 2] |= byte(d)
+		}
+	}
+	return ret
+}
+
+func UnpackSolution(packed [41]byte) (*Grid, error) {	// The inverse of PackSolution(). The digits become the grid's givens.
+	var values [9][9]int
+	for i := 0; i < 81; i++ {
+		d := int(packed[i / 2] & 0x0f)
+		if i % 2 == 0 {
+			d = int(packed[i / 2] >> 4)
+		}
+		if d < 1 || d > 9 {
+			return nil, fmt.Errorf("UnpackSolution(): bad digit %d for cell %d", d, i)
+		}
+		values[i % 9][i / 9] = d
+	}
+	grid, err := NewGridFromInts(values)
+	if err != nil {
+		return nil, err
+	}
+	return grid, nil
+}
+
+func (self *Grid) GivenMask() string {				// 81 chars in reading order, "1" for each given and "0" otherwise
+	var b strings.Builder
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			if self.IsGiven(x, y) {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+	}
+	return b.String()
+}
+
+type grid_json struct {
+	Cells		[9][9]json.RawMessage	`json:"cells"`		// Row by row, as in Rows()
+	Givens		[]Clue					`json:"givens"`
+}
+
+func (self *Grid) MarshalJSON() ([]byte, error) {
+
+	// Each cell is written as its digit if solved, or else as the list of its candidates (as per Candidates),
+	// so a grid part way through a solve survives the trip. The givens are included, but not the alphabet,
+	// step count, or any variant units.
+
+	var foo grid_json
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			var cell interface{} = self.Candidates(x, y)
+			if self.Count(x, y) == 1 {
+				cell = index_to_digit(self.Value(x, y))
+			} else if self.Count(x, y) == 0 {
+				cell = []int{}
+			}
+			b, err := json.Marshal(cell)
+			if err != nil {
+				return nil, err
+			}
+			foo.Cells[y][x] = b
+		}
+	}
+
+	foo.Givens = self.Givens()
+	if foo.Givens == nil {
+		foo.Givens = []Clue{}
+	}
+
+	return json.Marshal(foo)
+}
+
+func (self *Grid) UnmarshalJSON(data []byte) error {
+
+	// The inverse of MarshalJSON(). The candidates are restored exactly as written, with no propagation, and
+	// the grid gets a fresh step counter. Errors if a cell has no candidates, or a given isn't its cell's
+	// only candidate.
+
+	var foo grid_json
+
+	if err := json.Unmarshal(data, &foo); err != nil {
+		return fmt.Errorf("UnmarshalJSON(): %v", err)
+	}
+
+	ret := NewGrid()
+
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+
+			var digits []int
+			var digit int
+
+			if err := json.Unmarshal(foo.Cells[y][x], &digit); err == nil {
+				digits = []int{digit}
+			} else if err := json.Unmarshal(foo.Cells[y][x], &digits); err != nil {
+				return fmt.Errorf("UnmarshalJSON(): cell %d,%d is neither a digit nor a list of digits", x, y)
+			}
+
+			if len(digits) == 0 {
+				return fmt.Errorf("UnmarshalJSON(): cell %d,%d has no candidates", x, y)
+			}
+
+			var cell [9]bool
+			for _, d := range digits {
+				if d < 1 || d > 9 {
+					return fmt.Errorf("UnmarshalJSON(): cell %d,%d has bad digit %d", x, y, d)
+				}
+				cell[digit_to_index(d)] = true
+			}
+			ret.set_cell(x, y, cell)
+		}
+	}
+
+	for _, clue := range foo.Givens {
+		if clue.X < 0 || clue.X > 8 || clue.Y < 0 || clue.Y > 8 || clue.Digit < 1 || clue.Digit > 9 {
+			return fmt.Errorf("UnmarshalJSON(): bad given %v", clue)
+		}
+		if ret.Count(clue.X, clue.Y) != 1 || ret.Value(clue.X, clue.Y) != digit_to_index(clue.Digit) {
+			return fmt.Errorf("UnmarshalJSON(): given %d at %d,%d doesn't match its cell", clue.Digit, clue.X, clue.Y)
+		}
+		ret.givens[clue.X][clue.Y] = clue.Digit
+	}
+
+	*self = *ret
+	return nil
+}
+
+type Symmetry int
+
+const (
+	SymmetryRotational	Symmetry = iota		// 180 degree rotation
+	SymmetryHorizontal						// Mirrored top to bottom, about the middle row
+	SymmetryVertical						// Mirrored left to right, about the middle column
+	SymmetryDiagonal						// Mirrored about the top-left to bottom-right diagonal
+)
+
+var symmetry_names = [...]string{"rotational", "horizontal", "vertical", "diagonal"}
+
+func (self Symmetry) String() string {
+	return symmetry_names[self]
+}
+
+var symmetry_maps = [...]func(x, y int) (int, int){
+	func(x, y int) (int, int) { return 8 - x, 8 - y },
+	func(x, y int) (int, int) { return x, 8 - y },
+	func(x, y int) (int, int) { return 8 - x, y },
+	func(x, y int) (int, int) { return y, x },
+}
+
+func (self *Grid) ClueSymmetry() []Symmetry {		// Which symmetries the pattern of givens has (ignoring the digits themselves)
+
+	ret := []Symmetry{}
+
+	for i, f := range symmetry_maps {
+		ok := true
+		for x := 0; x < 9 && ok; x++ {
+			for y := 0; y < 9; y++ {
+				x2, y2 := f(x, y)
+				if self.IsGiven(x, y) != self.IsGiven(x2, y2) {
+					ok = false
+					break
+				}
+			}
+		}
+		if ok {
+			ret = append(ret, Symmetry(i))
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) puzzle_values() [9][9]int {		// The givens, or the solved cells if the grid has no givens recorded
+	if len(self.Givens()) == 0 {
+		return self.Values()
+	}
+	return self.givens
+}
+
+func (self *Grid) Canonical() string {
+
+	// A string identifying the puzzle (as per puzzle_values) up to rotation, reflection, and relabelling of the
+	// digits. We try all 8 rotations / reflections, relabel the digits in order of first appearance, and take
+	// the smallest result. Note that swapping rows within a band (and the like) is not considered.
+
+	values := self.puzzle_values()
+	best := ""
+
+	for t := 0; t < 8; t++ {
+
+		var labels [10]byte
+		next := byte('1')
+		b := []byte(strings.Repeat(".", 81))
+
+		for y := 0; y < 9; y++ {
+			for x := 0; x < 9; x++ {
+				sx, sy := dihedral(t, x, y)
+				d := values[sx][sy]
+				if d == 0 {
+					continue
+				}
+				if labels[d] == 0 {
+					labels[d] = next
+					next++
+				}
+				b[y * 9 + x] = labels[d]
+			}
+		}
+
+		if best == "" || string(b) < best {
+			best = string(b)
+		}
+	}
+
+	return best
+}
+
+func dihedral(t, x, y int) (int, int) {			// Transform t (0-7) of the board's 8 rotations / reflections, applied to x,y
+	if t & 4 != 0 {
+		x, y = y, x
+	}
+	if t & 1 != 0 {
+		x = 8 - x
+	}
+	if t & 2 != 0 {
+		y = 8 - y
+	}
+	return x, y
+}
+
+func (self *Grid) ShapeSignature() string {
+
+	// Like GivenMask(), but the same for all 8 rotations / reflections of the clue layout (we take the
+	// smallest), so puzzles whose givens form the same pattern share a signature whatever their digits.
+
+	best := ""
+
+	for t := 0; t < 8; t++ {
+		b := make([]byte, 81)
+		for y := 0; y < 9; y++ {
+			for x := 0; x < 9; x++ {
+				b[y * 9 + x] = '0'
+				if self.IsGiven(dihedral(t, x, y)) {
+					b[y * 9 + x] = '1'
+				}
+			}
+		}
+		if best == "" || string(b) < best {
+			best = string(b)
+		}
+	}
+
+	return best
+}
+
+func Dedupe(grids []*Grid, symmetric bool) ([]*Grid, int) {
+
+	// Remove repeated puzzles, keeping the first of each. With symmetric set, puzzles with the same
+	// Canonical() form count as repeats, otherwise only identical puzzles do. Returns the number removed.
+
+	var ret []*Grid
+	seen := make(map[string]bool)
+
+	for _, grid := range grids {
+		var key string
+		if symmetric {
+			key = grid.Canonical()
+		} else {
+			key = fmt.Sprint(grid.puzzle_values())
+		}
+		if seen[key] == false {
+			seen[key] = true
+			ret = append(ret, grid)
+		}
+	}
+
+	return ret, len(grids) - len(ret)
+}
+
+type Sheet struct {									// Digits for display only, with no candidates behind them, so it can't be searched
+	values		[9][9]int								// 1-9, or 0 for blank
+	alphabet	[]rune
+}
+
+func (self Sheet) Values() [9][9]int {				// As Grid.Values(). NewGridFromInts() on these gives a live grid.
+	return self.values
+}
+
+func (self Sheet) symbol(x, y int) rune {			// The symbol at x,y, or '.' if blank
+	if self.values[x][y] == 0 {
+		return '.'
+	}
+	if self.alphabet == nil {
+		return default_alphabet[self.values[x][y] - 1]
+	}
+	return self.alphabet[self.values[x][y] - 1]
+}
+
+func (self Sheet) Print() {
+	self.Fprint(os.Stdout)
+}
+
+func (self Sheet) Fprint(w io.Writer) error {		// As Grid.Fprint()
+	return fprint_layout(w, func(x, y int) string {
+		return string(self.symbol(x, y))
+	})
+}
+
+func (self Sheet) String() string {					// As Grid.String()
+	var ret []rune
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			ret = append(ret, self.symbol(x, y))
+		}
+	}
+	return string(ret)
+}
+
+func (self *Grid) MissingCells(solution *Grid) Sheet {
+
+	// For answer keys: the solution's values in the cells the solver had to fill, with the givens left blank.
+	// This returns a Sheet rather than the *Grid first asked for, since a live grid would propagate the values
+	// and fill the blanks straight back in. Use Values() to get at the digits.
+
+	ret := Sheet{alphabet: self.alphabet}
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if self.IsGiven(x, y) == false && solution.Count(x, y) == 1 {
+				ret.values[x][y] = index_to_digit(solution.Value(x, y))
+			}
+		}
+	}
+
+	return ret
+}
+
+func (self *Grid) BlankCandidates() Sheet {
+
+	// For logging or sharing: the givens and nothing else, so nothing found by propagation or play is revealed.
+	// Like MissingCells(), this returns a Sheet rather than the *Grid first asked for, since a live grid would
+	// propagate from the givens and reveal it all again. Use NewGridFromInts() on its Values() to get one.
+
+	ret := Sheet{alphabet: self.alphabet}
+
+	for _, clue := range self.Givens() {
+		ret.values[clue.X][clue.Y] = clue.Digit
+	}
+
+	return ret
+}
+
+func (self *Grid) CheckAgainstAny(player *Grid, maxSolutions int) (bool, error) {
+
+	// Whether the player's solved cells agree with at least one of the puzzle's solutions, so that a legitimate
+	// alternative placement in a non-unique puzzle isn't flagged as wrong. As with EnumerateSolutions(), at
+	// most maxSolutions solutions are examined (0 for no limit), in a single search. That search branches on
+	// the player's cells first, trying their entries before anything else, so if any solution agrees with
+	// them it's the first one found. The answer is therefore exact, and the search stops at that first
+	// solution whatever the limit. Returns ErrNoSolution if the puzzle has none.
+
+	if maxSolutions < 0 {
+		return false, fmt.Errorf("CheckAgainstAny(): bad maxSolutions %d", maxSolutions)
+	}
+
+	entries := player.Values()
+	matched := false
+
+	pick := func(g *Grid) (Point, []int) {
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				if entries[x][y] == 0 || g.Count(x, y) == 1 {
+					continue
+				}
+				n := digit_to_index(entries[x][y])
+				values := []int{n}
+				for _, v := range g.Possibles(x, y) {
+					if v != n {
+						values = append(values, v)
+					}
+				}
+				return Point{x, y}, values
+			}
+		}
+		return DefaultPick(g)
+	}
+
+	count := 0
+
+	foo := self.Copy()
+	foo.ResetSteps()								// Don't pollute the original's count
+
+	foo.run(&search{
+		pick: pick,
+		found: func(g *Grid) bool {
+			count++
+			matched = true
+			for x := 0; x < 9; x++ {
+				for y := 0; y < 9; y++ {
+					if entries[x][y] != 0 && g.Value(x, y) != digit_to_index(entries[x][y]) {
+						matched = false
+					}
+				}
+			}
+			return false							// The first solution decides, so it's within any limit
+		},
+	}, 0)
+
+	if count == 0 {
+		return false, ErrNoSolution
+	}
+
+	return matched, nil
+}
+
+func (self *Grid) SetFromString(s string) {
+
+	values, err := parse_values(s, self.symbols())
+
+	if err != nil {
+		panic("Bad puzzle string")
+	}
+
+	err = self.set_values(values)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ParseRows(s string) (*Grid, error) {
+
+	// Parse 9 lines of 9 cells each. Cells are the digits 1-9, or any of the blanks '.', '0', '-' or '_'.
+	// Other characters (e.g. spaces or '|' between cells) and blank lines are ignored.
+
+	var values [9][9]int
+	y := 0
+
+	for i, line := range strings.Split(s, "\n") {
+
+		var row []int
+
+		for _, c := range line {
+			if c >= '1' && c <= '9' {
+				row = append(row, int(c - '0'))
+			} else if c == '.' || c == '0' || c == '-' || c == '_' {
+				row = append(row, 0)
+			}
+		}
+
+		if len(row) == 0 {
+			continue
+		}
+
+		if len(row) != 9 {
+			return nil, fmt.Errorf("ParseRows(): line %d has %d cells, expected 9", i + 1, len(row))
+		}
+
+		if y == 9 {
+			return nil, fmt.Errorf("ParseRows(): line %d is a 10th row", i + 1)
+		}
+
+		for x := 0; x < 9; x++ {
+			values[x][y] = row[x]
+		}
+
+		y++
+	}
+
+	if y != 9 {
+		return nil, fmt.Errorf("ParseRows(): got %d rows, expected 9", y)
+	}
+
+	return NewGridFromInts(values)
+}
+
+func ParseBlock(s string) (*Grid, error) {
+
+	// Parse a puzzle pasted in any layout, e.g. 9 lines with spaces and '|' between the boxes and lines of
+	// '-' and '+' between the bands. Cells are the digits 1-9 or the blanks '.', '0' and '_'; everything else
+	// is skipped, including trailing spaces. Unlike ParseRows() (where '-' is a blank) rows aren't checked
+	// line by line, but there must be exactly 81 cells in all.
+
+	values, err := parse_values(strings.Replace(s, "_", ".", -1), default_alphabet)
+
+	if err != nil {
+		return nil, fmt.Errorf("ParseBlock(): %v", err)
+	}
+
+	return NewGridFromInts(values)
+}
+
+func ParseMasked(solution, mask string) (*Grid, error) {
+
+	// The inverse of GivenMask(): rebuild a puzzle from its solution string plus a mask of "1"s and "0"s saying
+	// which cells are givens. As with ParseString(), the grid is also returned on ErrContradictoryGivens.
+
+	full, err := parse_values(solution, default_alphabet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mask) != 81 {
+		return nil, fmt.Errorf("ParseMasked(): mask has %d chars, expected 81", len(mask))
+	}
+
+	var values [9][9]int
+
+	for i, c := range mask {
+		x, y := i % 9, i / 9
+		switch c {
+		case '0':
+		case '1':
+			if full[x][y] == 0 {
+				return nil, fmt.Errorf("ParseMasked(): %s is masked as a given but is empty", PointToName(Point{x, y}))
+			}
+			values[x][y] = full[x][y]
+		default:
+			return nil, fmt.Errorf("ParseMasked(): bad mask character %q", c)
+		}
+	}
+
+	return NewGridFromInts(values)
+}
+
+func NewGridFromInts(values [9][9]int) (*Grid, error) {
+
+	// A grid with the given digits (1-9, indexed [x][y] as in Values(), 0 for empty cells) as its givens.
+	// On ErrContradictoryGivens the grid is still returned with all its givens recorded, so that it can be
+	// passed to RepairGivens(). The other importers all build their grids through here.
+
+	ret := NewGrid()
+
+	if ret.set_values(values) != nil {
+		return ret, ErrContradictoryGivens
+	}
+
+	if _, _, legal := ret.branch_point(); !legal {		// Propagation from the givens alone emptied a cell
+		return ret, ErrContradictoryGivens
+	}
+
+	return ret, nil
+}
+
+func NewGridFromCandidates(cands [9][9][9]bool) *Grid {
+
+	// A grid in exactly the candidate state given, where cands[x][y][d-1] says whether digit d is possible
+	// at x,y. Nothing is propagated and there are no givens; this is for recreating states, e.g. from
+	// GoLiteral(). Whether such a grid is consistent is the caller's business.
+
+	ret := NewGrid()
+
+	var cells [9][9][9]bool
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			for d := 1; d <= 9; d++ {
+				cells[x][y][digit_to_index(d)] = cands[x][y][d - 1]
+			}
+		}
+	}
+
+	ret.set_cells(cells)
+	return ret
+}
+
+func (self *Grid) GoLiteral() string {
+
+	// Go source for recreating this grid state in a test: a call to NewGridFromInts() if every cell is solved,
+	// otherwise a call to NewGridFromCandidates() with a [9][9][9]bool literal of the candidates.
+
+	var b strings.Builder
+
+	if count_clues(self.Values()) == 81 {
+		values := self.Values()
+		b.WriteString("NewGridFromInts([9][9]int{\n")
+		for x := 0; x < 9; x++ {
+			b.WriteString("\t{")
+			for y := 0; y < 9; y++ {
+				if y > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "%d", values[x][y])
+			}
+			b.WriteString("},\n")
+		}
+		b.WriteString("})")
+		return b.String()
+	}
+
+	b.WriteString("NewGridFromCandidates([9][9][9]bool{\n")
+	for x := 0; x < 9; x++ {
+		b.WriteString("\t{\n")
+		for y := 0; y < 9; y++ {
+			b.WriteString("\t\t{")
+			for d := 1; d <= 9; d++ {
+				if d > 1 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "%v", self.cells[x][y][digit_to_index(d)])
+			}
+			b.WriteString("},\n")
+		}
+		b.WriteString("\t},\n")
+	}
+	b.WriteString("})")
+	return b.String()
+}
+
+// Builder assembles a puzzle a clue at a time, e.g. NewBuilder().Set(0, 0, 5).Set(4, 4, 1).Build(). Digits are
+// 1-9, as in Clue. Each clue is checked as it's added; after the first error, further calls are ignored and
+// Build() returns that error.
+
+type Builder struct {
+	grid		*Grid
+	err			error
+}
+
+func NewBuilder() *Builder {
+	return &Builder{grid: NewGrid()}
+}
+
+func (self *Builder) Set(x, y, digit int) *Builder {
+
+	if self.err != nil {
+		return self
+	}
+
+	if x < 0 || x > 8 || y < 0 || y > 8 || digit < 1 || digit > 9 {
+		self.err = fmt.Errorf("Builder.Set(): bad clue %d,%d = %d", x, y, digit)
+		return self
+	}
+
+	n := digit_to_index(digit)
+
+	if self.grid.cells[x][y][n] == false {
+		self.err = ErrContradictoryGivens
+		return self
+	}
+
+	self.grid.givens[x][y] = digit
+	self.grid.Set(x, y, n)
+
+	if _, _, legal := self.grid.branch_point(); !legal {
+		self.err = ErrContradictoryGivens
+	}
+
+	return self
+}
+
+func (self *Builder) Build() (*Grid, error) {		// The grid so far (a copy, so the builder can carry on), or the first error
+	if self.err != nil {
+		return nil, self.err
+	}
+	return self.grid.Copy(), nil
+}
+
+func ParseString(s string) (*Grid, error) {
+
+	// Like SetFromString() on a new grid, but returns errors instead of panicking. On ErrContradictoryGivens
+	// the grid is still returned with all its givens recorded, so that it can be passed to RepairGivens().
+
+	values, err := parse_values(s, default_alphabet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGridFromInts(values)
+}
+
+func SolveString(s string) (*Grid, error) {			// Parse and solve a puzzle, requiring a unique solution
+
+	grid, err := ParseString(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return grid.SolveUnique()
+}
+
+type EngineResult struct {							// One puzzle, as solved by both engines. See CompareEngines().
+	Puzzle			string
+	Err				error							// If not nil (e.g. ErrContradictoryGivens) neither engine searched, and the rest is zero
+	Solved			bool							// Whether both engines found a solution
+	ArraySteps		int
+	ArrayTime		time.Duration
+	NorvigSteps		int
+	NorvigTime		time.Duration
+}
+
+type EngineComparison struct {
+	Results			[]EngineResult					// In input order
+	ArraySteps		int								// Totals over all puzzles
+	ArrayTime		time.Duration
+	NorvigSteps		int
+	NorvigTime		time.Duration
+}
+
+func (self EngineComparison) Ratio() float64 {		// Norvig's total time over this file's, or 0 if nothing was timed
+	if self.ArrayTime == 0 {
+		return 0
+	}
+	return float64(self.NorvigTime) / float64(self.ArrayTime)
+}
+
+func CompareEngines(puzzles []string) EngineComparison {
+
+	// Solves every puzzle (81-char lines) with this file's engine and then the norvig package's, one at a time
+	// so the timings don't compete, and reports each one's search tree size and time. The norvig package
+	// claims to be about 10x slower; this measures it. Neither engine uses pairs, so the step counts measure
+	// comparable searches.
+
+	var ret EngineComparison
+
+	for _, puzzle := range puzzles {
+
+		result := EngineResult{Puzzle: puzzle}
+
+		grid, err := ParseString(puzzle)
+		var other norvig.Solver
+
+		if err == nil {
+			err = other.Parse(puzzle)
+		}
+
+		if err != nil {
+			result.Err = err
+			ret.Results = append(ret.Results, result)
+			continue
+		}
+
+		start := time.Now()
+		solution := grid.Solve()
+		result.ArrayTime = time.Now().Sub(start)
+		result.ArraySteps = grid.Steps()
+
+		start = time.Now()
+		solved := other.Solve()
+		result.NorvigTime = time.Now().Sub(start)
+		result.NorvigSteps = other.Steps()
+
+		result.Solved = solution != nil && solved
+
+		ret.Results = append(ret.Results, result)
+		ret.ArraySteps += result.ArraySteps
+		ret.ArrayTime += result.ArrayTime
+		ret.NorvigSteps += result.NorvigSteps
+		ret.NorvigTime += result.NorvigTime
+	}
+
+	return ret
+}
+
+func SolveVerified(puzzle string) (string, error) {
+
+	// Solve with both engines - this file's and the norvig package's, which share nothing but the 81-char
+	// format - and return the solution only if they agree and it passes Validate(). The puzzle must also be
+	// unique, which is checked separately. For when correctness matters more than speed.
+
+	grid, err := ParseString(puzzle)
+
+	if err != nil {
+		return "", err
+	}
+
+	var givens []byte								// Only the givens go to norvig, so it does its own propagation
+	values := grid.puzzle_values()
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			givens = append(givens, "0123456789"[values[x][y]])
+		}
+	}
+
+	var other norvig.Solver
+
+	if err := other.Parse(string(givens)); err != nil {
+		return "", fmt.Errorf("SolveVerified(): engines disagree about the givens: %v", err)
+	}
+
+	a := grid.Copy().Solve()
+	b := other.Solve()
+
+	if a == nil && b == false {
+		return "", ErrNoSolution
+	}
+
+	if a == nil || b == false {
+		return "", errors.New("SolveVerified(): engines disagree about whether there's a solution")
+	}
+
+	if grid.CountSolutions(2) > 1 {
+		return "", ErrMultipleSolutions
+	}
+
+	if a.String() != other.String() {
+		return "", errors.New("SolveVerified(): engines found different solutions")
+	}
+
+	if !a.Validate() || !other.Validate() {
+		return "", errors.New("SolveVerified(): solution failed validation")
+	}
+
+	return a.String(), nil
+}
+
+func SolveWithConfidence(probs [9][9][10]float64, threshold float64) (*Grid, error) {
+
+	// For OCR-style input: probs[x][y][d] is the confidence that cell x,y holds digit d, with d == 0 meaning
+	// the cell is blank. A cell becomes a given only if its most likely reading is a digit whose confidence
+	// exceeds threshold; everything else is left for the solver. A unique solution is required. On
+	// ErrContradictoryGivens the unsolved grid is returned, so that it can be passed to RepairGivens().
+
+	var values [9][9]int
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			best := 0
+			for d := 1; d <= 9; d++ {
+				if probs[x][y][d] > probs[x][y][best] {
+					best = d
+				}
+			}
+			if best != 0 && probs[x][y][best] > threshold {
+				values[x][y] = best
+			}
+		}
+	}
+
+	grid, err := NewGridFromInts(values)
+
+	if err != nil {
+		return grid, err
+	}
+
+	return grid.SolveUnique()
+}
+
+func LoadPuzzleFile(filename string) ([]*Grid, error) {
+
+	// Load every puzzle in a file, one per line. As in cmd/sudoku, lines shorter than 81 chars are skipped.
+	// Puzzles with contradictory givens are still included (see ParseString) since they're real entries.
+
+	f, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*Grid
+
+	for i, line := range strings.Split(string(f), "\n") {
+
+		if len(line) < 81 {
+			continue
+		}
+
+		grid, err := ParseString(line)
+
+		if err != nil && !errors.Is(err, ErrContradictoryGivens) {
+			return nil, fmt.Errorf("%s line %d: %v", filename, i + 1, err)
+		}
+
+		ret = append(ret, grid)
+	}
+
+	return ret, nil
+}
+
+type DatasetReport struct {
+	Puzzles			int
+	Difficulties	map[string]int					// Counts per Difficulty() rating, for puzzles with a solution
+	MeanGivens		float64
+	MedianGivens	float64
+	MeanSteps		float64							// Mean search tree size to find the first solution
+	NonUnique		int
+	Unsolvable		int
+}
+
+func DatasetStats(grids []*Grid) DatasetReport {
+
+	var ret DatasetReport
+	var givens []int
+	total_steps := 0
+
+	ret.Puzzles = len(grids)
+	ret.Difficulties = make(map[string]int)
+
+	for _, grid := range grids {
+
+		givens = append(givens, len(grid.Givens()))
+
+		foo := grid.Copy()
+		foo.ResetSteps()								// Don't pollute the original's count
+
+		solution, stats := foo.SolveWithStats()
+		total_steps += stats.Steps
+
+		if solution == nil {
+			ret.Unsolvable++
+			continue
+		}
+
+		ret.Difficulties[difficulty_for_steps(stats.Steps)]++
+
+		// Uniqueness is the one thing the first solution can't tell us, so only solvable puzzles get a second look...
+
+		if grid.CountSolutions(2) > 1 {
+			ret.NonUnique++
+		}
+	}
+
+	if len(grids) == 0 {
+		return ret
+	}
+
+	sort.Ints(givens)
+
+	sum := 0
+	for _, n := range givens {
+		sum += n
+	}
+
+	ret.MeanGivens = float64(sum) / float64(len(givens))
+	ret.MeanSteps = float64(total_steps) / float64(len(grids))
+
+	if len(givens) % 2 == 1 {
+		ret.MedianGivens = float64(givens[len(givens) / 2])
+	} else {
+		ret.MedianGivens = float64(givens[len(givens) / 2 - 1] + givens[len(givens) / 2]) / 2
+	}
+
+	return ret
+}
+
+func SolveToWriter(in io.Reader, out io.Writer) error {
+
+	// Read puzzles line by line, writing each solution as an 81-char line in the same order. Puzzles which
+	// can't be parsed or solved get an empty line, so the output lines always match the input puzzles.
+	// Blank input lines are skipped. Only I/O errors are returned.
+
+	scanner := bufio.NewScanner(in)
+	w := bufio.NewWriter(out)
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		result := ""
+
+		if grid, err := ParseString(line); err == nil {
+			if solution := grid.Solve(); solution != nil {
+				rows := solution.Rows()
+				result = strings.Join(rows[:], "")
+			}
+		}
+
+		if _, err := fmt.Fprintln(w, result); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+type SolveResult struct {
+	Input		string		`json:"input"`
+	Solution	*string		`json:"solution"`				// 81 chars, or null if there isn't one
+	Status		string		`json:"status"`					// "solved", "no solution", "contradictory givens" or "bad puzzle"
+	Stats												// Of the search, if there was one; its fields appear inline
+	TimeMs		float64		`json:"time_ms"`				// Including the parse
+}
+
+func SolveToJSON(in io.Reader, out io.Writer) error {
+
+	// Like SolveToWriter(), but writes one JSON-encoded SolveResult per line for each input puzzle.
+
+	scanner := bufio.NewScanner(in)
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		result := SolveResult{Input: line}
+		start_time := time.Now()
+
+		grid, err := ParseString(line)
+
+		if errors.Is(err, ErrContradictoryGivens) {
+			result.Status = "contradictory givens"
+		} else if err != nil {
+			result.Status = "bad puzzle"
+		} else if solution, stats := grid.SolveWithStats(); solution == nil {
+			result.Status = "no solution"
+			result.Stats = stats
+		} else {
+			rows := solution.Rows()
+			s := strings.Join(rows[:], "")
+			result.Status = "solved"
+			result.Solution = &s
+			result.Stats = stats
+		}
+
+		result.TimeMs = float64(time.Now().Sub(start_time)) / float64(time.Millisecond)
+
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// ------------------------------------------------------------------------------------------------
+// Format conversion
+
+type Format int
+
+const (
+	FormatLine		Format = iota		// One puzzle per line, 81 chars, "." for empty cells
+	FormatPretty						// The bordered grid drawn by Print(), puzzles separated by blank lines
+	FormatCSV							// One puzzle per line, 81 comma-separated digits, 0 for empty cells
+	FormatSDK							// SadMan .sdk style: 9 lines of 9 chars, "#" comment lines, blank line between puzzles
+)
+
+var format_names = map[string]Format{
+	"line":		FormatLine,
+	"pretty":	FormatPretty,
+	"csv":		FormatCSV,
+	"sdk":		FormatSDK,
+}
+
+func ParseFormat(name string) (Format, error) {		// Accepts "line", "pretty", "csv" or "sdk"
+	f, ok := format_names[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("ParseFormat(): unknown format %q", name)
+	}
+	return f, nil
+}
+
+func Convert(in io.Reader, out io.Writer, from, to Format) error {
+
+	// Read every puzzle from in, writing each to out in the other format. Only the puzzle itself is
+	// converted - nothing is solved or propagated - so a round trip gives back the same puzzles. The
+	// first unparseable puzzle aborts the conversion with an error giving its position in the input.
+
+	scanner := bufio.NewScanner(in)
+	w := bufio.NewWriter(out)
+
+	var block []string			// Lines of the multi-line puzzle being collected
+	puzzle_id := 0
+
+	emit := func(text string) error {
+		puzzle_id++
+		values, err := parse_values(text, default_alphabet)
+		if err != nil {
+			return fmt.Errorf("Convert(): puzzle %d: %v", puzzle_id, err)
+		}
+		return write_format(w, values, to, puzzle_id == 1)
+	}
+
+	for scanner.Scan() {
+
+		line := strings.TrimSpace(scanner.Text())
+
+		switch from {
+		case FormatLine, FormatCSV:
+			if line == "" {
+				continue
+			}
+			if err := emit(line); err != nil {
+				return err
+			}
+		case FormatPretty, FormatSDK:
+			if from == FormatSDK && strings.HasPrefix(line, "#") {
+				continue
+			}
+			if line == "" {
+				if len(block) > 0 {
+					if err := emit(strings.Join(block, "\n")); err != nil {
+						return err
+					}
+					block = nil
+				}
+				continue
+			}
+			block = append(block, line)
+		default:
+			return fmt.Errorf("Convert(): unknown input format %d", from)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(block) > 0 {
+		if err := emit(strings.Join(block, "\n")); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func write_format(w io.Writer, values [9][9]int, f Format, first bool) error {		// Write one puzzle in the given format
+
+	symbol := func(x, y int, empty string) string {
+		if values[x][y] == 0 {
+			return empty
+		}
+		return string(default_alphabet[values[x][y] - 1])
+	}
+
+	var err error
+
+	switch f {
+
+	case FormatLine:
+		line := ""
+		for y := 0; y < 9; y++ {
+			for x := 0; x < 9; x++ {
+				line += symbol(x, y, ".")
+			}
+		}
+		_, err = fmt.Fprintln(w, line)
+
+	case FormatCSV:
+		var fields []string
+		for y := 0; y < 9; y++ {
+			for x := 0; x < 9; x++ {
+				fields = append(fields, symbol(x, y, "0"))
+			}
+		}
+		_, err = fmt.Fprintln(w, strings.Join(fields, ","))
+
+	case FormatPretty:
+		if !first {
+			if _, err = fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		err = fprint_layout(w, func(x, y int) string {
+			return symbol(x, y, ".")
+		})
+
+	case FormatSDK:
+		if !first {
+			if _, err = fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		for y := 0; y < 9 && err == nil; y++ {
+			line := ""
+			for x := 0; x < 9; x++ {
+				line += symbol(x, y, ".")
+			}
+			_, err = fmt.Fprintln(w, line)
+		}
+
+	default:
+		err = fmt.Errorf("Convert(): unknown output format %d", f)
+	}
+
+	return err
+}
+
+// ------------------------------------------------------------------------------------------------
+
+func init() {
+	build_unit_tables()
+	build_peer_tables()
+
+	if len(all_units) != 27 {
+		panic("all_units invalid")
+	}
+	for _, unit := range all_units {
+		if len(unit) != 9 {
+			panic("unit invalid")
+		}
+	}
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if len(lookup_peers[x][y]) != 20 {
+				panic("peer list invalid")
+			}
+			if len(lookup_units[x][y]) != 3 {
+				panic("unit list invalid")
+			}
+			for _, unit := range lookup_units[x][y] {
+				if len(unit) != 9 {
+					panic("unit invalid")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,602 @@
+package sudoku
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rooklift/sudoku/norvig"
+)
+
+func load_test_puzzles(tb testing.TB) []*Grid {
+	puzzles, err := LoadPuzzleFile("puzzles.txt")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return puzzles
+}
+
+func parse_test_puzzle(tb testing.TB, s string) *Grid {
+	grid, err := ParseString(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return grid
+}
+
+const test_puzzle = "4.....8.5.3..........7......2.....6.....8.4......1.......6.3.7.5..2.....1.4......"
+
+// ------------------------------------------------------------------------------------------------
+// Tests
+
+func TestTransposeTwice(t *testing.T) {
+	grid := parse_test_puzzle(t, test_puzzle)
+	foo := grid.Transpose().Transpose()
+	if foo.cells != grid.cells || foo.counts != grid.counts || foo.givens != grid.givens {
+		t.Errorf("transposing twice changed the grid:\n%v\n%v", grid, foo)
+	}
+}
+
+func TestBiValueCells(t *testing.T) {
+	for _, grid := range load_test_puzzles(t) {
+		var expected []Point
+		for x := 0; x < 9; x++ {
+			for y := 0; y < 9; y++ {
+				if len(grid.Possibles(x, y)) == 2 {
+					expected = append(expected, Point{x, y})
+				}
+			}
+		}
+		got := grid.BiValueCells()
+		if len(got) != len(expected) {
+			t.Fatalf("%v: got %d cells, expected %d", grid, len(got), len(expected))
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Fatalf("%v: got %v, expected %v", grid, got, expected)
+			}
+		}
+	}
+}
+
+func TestXYWing(t *testing.T) {
+
+	// Replay the human solve of this puzzle up to its first xy-wing, then check the detector finds the
+	// expected elimination there and that applying it removes the candidate.
+
+	grid := parse_test_puzzle(t, "..9..5..3.....9...7.....596.365..4.....3...6..28....3.3..75.6..6...........1263.8")
+	_, steps, err := grid.SolveHuman()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foo := grid.pencil_grid()
+	for _, step := range steps {
+		if step.Technique == "xy-wing" {
+			break
+		}
+		foo.apply_step(step)
+	}
+
+	expected := Step{"xy-wing", 2, 7, 2, true}
+	found := foo.find_xy_wing()
+
+	if len(found) == 0 || found[0] != expected {
+		t.Fatalf("got %v, expected %v first", found, expected)
+	}
+
+	if foo.EliminateXYWing() == false || foo.cells[2][7][digit_to_index(2)] {
+		t.Errorf("EliminateXYWing() didn't remove 2 from 2,7")
+	}
+}
+
+func TestPointNames(t *testing.T) {
+	seen := make(map[string]bool)
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			name := PointToName(Point{x, y})
+			p, err := NameToPoint(name)
+			if err != nil || p != (Point{x, y}) {
+				t.Errorf("%d,%d -> %q -> %v, %v", x, y, name, p, err)
+			}
+			seen[name] = true
+		}
+	}
+	if len(seen) != 81 {
+		t.Errorf("got %d distinct names, expected 81", len(seen))
+	}
+}
+
+func TestPercentComplete(t *testing.T) {
+
+	// The first 40 cells in reading order from a solution, placed without propagation so nothing else fills in.
+
+	solution := parse_test_puzzle(t, test_puzzle).Solve()
+	grid := NewGrid()
+
+	for i := 0; i < 40; i++ {
+		grid.set_only(i % 9, i / 9, solution.Value(i % 9, i / 9))
+	}
+
+	if got := grid.PercentComplete(); got != 40.0 / 81.0 {
+		t.Errorf("got %v, expected %v", got, 40.0 / 81.0)
+	}
+	if got := NewGrid().PercentComplete(); got != 0 {
+		t.Errorf("empty grid: got %v, expected 0", got)
+	}
+	if got := solution.PercentComplete(); got != 1 {
+		t.Errorf("solution: got %v, expected 1", got)
+	}
+}
+
+func TestTryEliminationsContradiction(t *testing.T) {
+
+	// Eliminating every candidate of an unsolved cell must fail, and leave the grid exactly as it was.
+
+	grid := parse_test_puzzle(t, test_puzzle)
+	cells, counts := grid.cells, grid.counts
+
+	if grid.Count(1, 0) < 2 {
+		t.Fatal("expected 1,0 to be unsolved")
+	}
+
+	var elims []struct{ P Point; Val int }
+	for _, n := range grid.Possibles(1, 0) {
+		elims = append(elims, struct{ P Point; Val int }{Point{1, 0}, n})
+	}
+
+	if grid.TryEliminations(elims) {
+		t.Fatal("TryEliminations() accepted a contradictory batch")
+	}
+	if grid.cells != cells || grid.counts != counts {
+		t.Errorf("TryEliminations() didn't restore the grid")
+	}
+}
+
+func TestScore(t *testing.T) {
+
+	fiendish := parse_test_puzzle(t, test_puzzle)
+	base := ScoreDifficultyPoints[difficulty_rank("fiendish")]
+
+	if fiendish.Difficulty() != "fiendish" {
+		t.Fatalf("expected the test puzzle to be fiendish, got %q", fiendish.Difficulty())
+	}
+
+	tests := []struct {
+		hints, mistakes	int
+		elapsed			time.Duration
+		expected		int
+	}{
+		{0, 0, ScoreParTime, base},									// No time bonus at par
+		{0, 0, 2 * ScoreParTime, base},
+		{0, 0, 0, base + ScoreTimeBonus},							// The full bonus for an instant solve
+		{0, 0, ScoreParTime / 4, base + ScoreTimeBonus * 3 / 4},	// Falling linearly
+		{2, 3, ScoreParTime, base - 2 * ScoreHintPenalty - 3 * ScoreMistakePenalty},
+		{1000, 0, 0, 0},											// Never below 0
+	}
+
+	for _, test := range tests {
+		if got := fiendish.Score(test.hints, test.mistakes, test.elapsed); got != test.expected {
+			t.Errorf("Score(%d, %d, %v): got %d, expected %d", test.hints, test.mistakes, test.elapsed, got, test.expected)
+		}
+	}
+
+	solved := fiendish.Solve()				// Solved by propagation alone, so "easy"
+	if got := solved.Score(0, 0, ScoreParTime); got != ScoreDifficultyPoints[0] {
+		t.Errorf("easy: got %d, expected %d", got, ScoreDifficultyPoints[0])
+	}
+
+	var values [9][9]int
+	values[0][0], values[1][0] = 5, 5
+	bad, _ := NewGridFromInts(values)
+	if got := bad.Score(0, 0, 0); got != 0 {
+		t.Errorf("unsolvable: got %d, expected 0", got)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+
+	grid := parse_test_puzzle(t, test_puzzle)
+	solution := grid.Solve()
+
+	var moves []Point							// Unsolved cells, to fill from the solution
+	for y := 0; y < 9 && len(moves) < 4; y++ {
+		for x := 0; x < 9 && len(moves) < 4; x++ {
+			if grid.Count(x, y) > 1 {
+				moves = append(moves, Point{x, y})
+			}
+		}
+	}
+
+	play := func(p Point) {
+		if err := grid.SetDigit(p.X, p.Y, index_to_digit(solution.Value(p.X, p.Y))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	play(moves[0])
+	play(moves[1])
+
+	checkpoint := grid.Checkpoint()
+	cells, counts, givens := grid.cells, grid.counts, grid.givens
+
+	play(moves[2])
+	play(moves[3])
+
+	if grid.cells == cells {
+		t.Fatal("the later moves didn't change the grid")
+	}
+
+	grid.Restore(checkpoint)
+
+	if grid.cells != cells || grid.counts != counts || grid.givens != givens {
+		t.Errorf("Restore() didn't put the grid back as it was at the checkpoint")
+	}
+}
+
+func TestPackSolution(t *testing.T) {
+	for _, puzzle := range load_test_puzzles(t) {
+		solution := puzzle.Solve()
+		if solution == nil {
+			continue
+		}
+		packed := solution.PackSolution()
+		grid, err := UnpackSolution(packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if grid.Values() != solution.Values() || grid.PackSolution() != packed {
+			t.Fatalf("round trip failed:\n%v\n%v", solution, grid)
+		}
+	}
+}
+
+func TestDigitCounts(t *testing.T) {
+	solution := parse_test_puzzle(t, test_puzzle).Solve()
+	if solution == nil || solution.Validate() == false {
+		t.Fatal("expected a valid solution")
+	}
+	expected := [10]int{0, 9, 9, 9, 9, 9, 9, 9, 9, 9}
+	if got := solution.DigitCounts(); got != expected {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	if got := NewGrid().DigitCounts(); got != [10]int{81} {
+		t.Errorf("empty grid: got %v", got)
+	}
+}
+
+func TestXSudoku(t *testing.T) {
+
+	// A 17 clue X-Sudoku. It's unique only because of the diagonals: as a classic puzzle it has many solutions.
+
+	const puzzle = "28..3.....1..2...4.........5.3.........9.............2427.....88.....7.....5....."
+	const expected = "284731695719625384356489127543812976172946853968357412427193568895264731631578249"
+
+	grid, err := NewGridWithUnits(DiagonalUnits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid.SetFromString(puzzle)
+
+	if n := grid.CountSolutions(2); n != 1 {
+		t.Fatalf("got %d solutions, expected 1", n)
+	}
+	if n := parse_test_puzzle(t, puzzle).CountSolutions(2); n != 2 {
+		t.Fatalf("as a classic puzzle: got %d solutions, expected 2 (the limit)", n)
+	}
+
+	solution := grid.Solve()
+	if solution == nil || solution.String() != expected {
+		t.Fatalf("got %v, expected %s", solution, expected)
+	}
+
+	values := solution.Values()
+	var diag, anti [10]bool
+	for i := 0; i < 9; i++ {
+		diag[values[i][i]] = true
+		anti[values[8 - i][i]] = true
+	}
+	for d := 1; d <= 9; d++ {
+		if !diag[d] || !anti[d] {
+			t.Errorf("digit %d is missing from a diagonal", d)
+		}
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+
+	// Row 0 holds 1-7 in the first grid, so the other grid's 8 forces a 9 into the last cell by propagation.
+	// The other grid's 7 there must then be reported, not silently dropped.
+
+	mine := NewGrid()
+	for x := 0; x < 7; x++ {
+		if err := mine.SetDigit(x, 0, x + 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	theirs := NewGrid()
+	if theirs.SetDigit(7, 0, 8) != nil || theirs.SetDigit(8, 0, 7) != nil {
+		t.Fatal("couldn't set up the other grid")
+	}
+
+	if merged, err := mine.Merge(theirs); err == nil {
+		t.Errorf("Merge() accepted conflicting placements, giving %v", merged)
+	}
+
+	agreeing := NewGrid()
+	if agreeing.SetDigit(7, 0, 8) != nil || agreeing.SetDigit(8, 0, 9) != nil {
+		t.Fatal("couldn't set up the agreeing grid")
+	}
+
+	merged, err := mine.Merge(agreeing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := merged.Values(); v[7][0] != 8 || v[8][0] != 9 {
+		t.Errorf("got %d and %d at the end of row 0, expected 8 and 9", v[7][0], v[8][0])
+	}
+}
+
+func TestSolveVerified(t *testing.T) {
+
+	for _, puzzle := range load_test_puzzles(t) {
+		got, err := SolveVerified(puzzle.String())
+		if puzzle.CountSolutions(2) != 1 {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %s", puzzle, got)
+			}
+			continue
+		}
+		if err != nil || got != puzzle.Solve().String() {
+			t.Errorf("%v: got %q, %v", puzzle, got, err)
+		}
+	}
+
+	empty := NewGrid().String()
+	if _, err := SolveVerified(empty); !errors.Is(err, ErrMultipleSolutions) {
+		t.Errorf("empty grid: got %v, expected ErrMultipleSolutions", err)
+	}
+}
+
+func TestCheckAgainstAny(t *testing.T) {
+
+	// With three clues gone the test puzzle has many solutions. A player who has filled in one found late in
+	// the enumeration must still be accepted, even with a limit of 1.
+
+	values := parse_test_puzzle(t, test_puzzle).givens
+	values[0][0], values[6][0], values[8][0] = 0, 0, 0
+	puzzle, err := NewGridFromInts(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var solutions []*Grid
+	puzzle.EnumerateSolutions(50, func(g *Grid) bool {
+		solutions = append(solutions, g)
+		return true
+	})
+	if len(solutions) < 50 {
+		t.Fatalf("expected at least 50 solutions, got %d", len(solutions))
+	}
+
+	if ok, err := puzzle.CheckAgainstAny(solutions[49], 1); !ok || err != nil {
+		t.Errorf("a valid alternative solution was rejected: %v, %v", ok, err)
+	}
+
+	wrong := solutions[0].Values()				// Swapping two cells of a row keeps the row complete but breaks the columns
+	wrong[0][1], wrong[1][1] = wrong[1][1], wrong[0][1]
+	player := NewGrid()
+	player.set_values(wrong)
+	if ok, err := puzzle.CheckAgainstAny(player, 0); ok || err != nil {
+		t.Errorf("wrong entries were accepted: %v, %v", ok, err)
+	}
+
+	impossible := NewGrid()						// Three cells of a row sharing two digits, which propagation alone won't notice
+	for x := 0; x < 3; x++ {
+		for n := 2; n < 9; n++ {
+			impossible.remove_possible(x, 0, n)
+		}
+	}
+	if _, err := impossible.CheckAgainstAny(NewGrid(), 0); !errors.Is(err, ErrNoSolution) {
+		t.Errorf("got %v, expected ErrNoSolution", err)
+	}
+}
+
+func TestCompareEngines(t *testing.T) {
+
+	var puzzles []string
+	for _, grid := range load_test_puzzles(t) {
+		puzzles = append(puzzles, grid.String())
+	}
+	puzzles = append(puzzles, "55" + NewGrid().String()[2:])		// Contradictory
+
+	report := CompareEngines(puzzles)
+
+	if len(report.Results) != len(puzzles) {
+		t.Fatalf("got %d results, expected %d", len(report.Results), len(puzzles))
+	}
+
+	for i, r := range report.Results[:len(puzzles) - 1] {
+		if r.Err != nil || !r.Solved || r.ArraySteps < 1 || r.NorvigSteps < 1 {
+			t.Errorf("puzzle %d: %+v", i + 1, r)
+		}
+	}
+
+	if last := report.Results[len(puzzles) - 1]; !errors.Is(last.Err, ErrContradictoryGivens) || last.ArraySteps != 0 {
+		t.Errorf("contradictory puzzle: %+v", last)
+	}
+
+	// The claim in the norvig package is about 10x. Timings are noisy, so only check the direction here;
+	// BenchmarkSolve and BenchmarkSolveNorvig give the real numbers.
+
+	if report.Ratio() <= 1 {
+		t.Errorf("norvig took %.1fx as long, expected it to be slower", report.Ratio())
+	}
+}
+
+func TestAlphabetDisplay(t *testing.T) {
+
+	// With letters for digits, nothing drawn from the grid should show a digit.
+
+	grid := parse_test_puzzle(t, test_puzzle)
+	if err := grid.SetAlphabet("ABCDEFGHI"); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	grid.Fprint(&b)
+	grid.DemonstrateStrategy(StrategyAll, &b)
+	drawn := b.String()
+
+	for _, line := range strings.Split(drawn, "\n") {
+		if strings.HasPrefix(line, "After") {		// The heading includes a count
+			continue
+		}
+		if strings.ContainsAny(line, "123456789") {
+			t.Errorf("digit drawn: %q", line)
+		}
+	}
+	if !strings.ContainsAny(drawn, "ABCDEFGHI") {
+		t.Errorf("no letters drawn")
+	}
+
+	// The hint should read the same as with digits, except for the digit itself, which is always its last number...
+
+	plain, _, err := parse_test_puzzle(t, test_puzzle).Coach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := grid.AvailableDeductions()[0].Digit
+	i := strings.LastIndex(plain, fmt.Sprintf(" %d", d))
+	expected := plain[:i + 1] + string("ABCDEFGHI"[d - 1]) + plain[i + 2:]
+
+	if msg, _, _ := grid.Coach(); msg != expected {
+		t.Errorf("got %q, expected %q", msg, expected)
+	}
+}
+
+func TestMissingCells(t *testing.T) {
+
+	// The answer key is a Sheet: the givens are blank and every other cell holds the solution, even though a
+	// live grid would fill those blanks back in.
+
+	puzzle := parse_test_puzzle(t, test_puzzle)
+	solution := puzzle.Solve()
+
+	var key Sheet = puzzle.MissingCells(solution)
+
+	values, answer := key.Values(), solution.Values()
+
+	for x := 0; x < 9; x++ {
+		for y := 0; y < 9; y++ {
+			if puzzle.IsGiven(x, y) && values[x][y] != 0 {
+				t.Errorf("given at %d,%d isn't blank", x, y)
+			}
+			if !puzzle.IsGiven(x, y) && values[x][y] != answer[x][y] {
+				t.Errorf("%d,%d: got %d, expected %d", x, y, values[x][y], answer[x][y])
+			}
+		}
+	}
+
+	if n := strings.Count(key.String(), "."); n != len(puzzle.Givens()) {
+		t.Errorf("got %d blanks, expected one per given (%d)", n, len(puzzle.Givens()))
+	}
+}
+
+func TestBlankCandidates(t *testing.T) {
+
+	// ParseString() propagates, so the grid shows more than the givens; the Sheet must show only the givens,
+	// and still lead back to the same puzzle through NewGridFromInts().
+
+	grid := parse_test_puzzle(t, test_puzzle)
+	if grid.String() == test_puzzle {
+		t.Fatal("expected propagation to have solved some cells")
+	}
+
+	var blank Sheet = grid.BlankCandidates()
+
+	if blank.String() != test_puzzle {
+		t.Errorf("got %s, expected %s", blank.String(), test_puzzle)
+	}
+
+	live, err := NewGridFromInts(blank.Values())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.String() != grid.String() || live.Solve().String() != grid.Solve().String() {
+		t.Errorf("the live grid from Values() doesn't match the original")
+	}
+}
+
+func TestTransposeKeepsUnits(t *testing.T) {
+
+	// The X-Sudoku from TestXSudoku is only unique with its diagonals, so a transposed copy that lost them
+	// would have many solutions.
+
+	grid, err := NewGridWithUnits(DiagonalUnits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid.SetFromString("28..3.....1..2...4.........5.3.........9.............2427.....88.....7.....5.....")
+
+	foo := grid.Transpose()
+
+	if n := foo.CountSolutions(2); n != 1 {
+		t.Fatalf("transposed X-Sudoku: got %d solutions, expected 1", n)
+	}
+	if foo.Solve().Values() != grid.Solve().Transpose().Values() {
+		t.Errorf("the transposed puzzle's solution isn't the transposed solution")
+	}
+}
+
+// ------------------------------------------------------------------------------------------------
+// Benchmarks
+
+func BenchmarkSolve(b *testing.B) {
+	puzzles := load_test_puzzles(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, puzzle := range puzzles {
+			puzzle.Solve()
+		}
+	}
+}
+
+func BenchmarkSolveNorvig(b *testing.B) {		// Compare with BenchmarkSolve; the norvig package claims about 10x slower
+	var puzzles []string
+	for _, grid := range load_test_puzzles(b) {
+		puzzles = append(puzzles, grid.String())
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, puzzle := range puzzles {
+			var solver norvig.Solver
+			solver.Parse(puzzle)
+			solver.Solve()
+		}
+	}
+}
+
+func BenchmarkSolveDLX(b *testing.B) {
+	puzzles := load_test_puzzles(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, puzzle := range puzzles {
+			puzzle.SolveDLX()
+		}
+	}
+}
+
+func BenchmarkSolveInPlace(b *testing.B) {
+	puzzles := load_test_puzzles(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, puzzle := range puzzles {
+			puzzle.SolveInPlace()
+		}
+	}
+}